@@ -0,0 +1,169 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	approvalsPath = "/approvals"
+)
+
+// AdminServer serves the approval queue to operators over a local unix socket.
+type AdminServer struct {
+	srv *http.Server
+}
+
+// NewAdminServer starts serving the queue in socketPath. The socket is only
+// accessible by the user running the daemon.
+func NewAdminServer(socketPath string, q *Queue) (*AdminServer, error) {
+	// A socket file left by a daemon that didn't shut down cleanly would fail listening.
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("removing stale admin socket: %s", err)
+	}
+	l, err := listenPrivate(socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("listening on admin socket: %s", err)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("restricting admin socket permissions: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(approvalsPath, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(q.Pending()); err != nil {
+			log.Errorf("writing pending approvals: %s", err)
+		}
+	})
+	mux.HandleFunc(approvalsPath+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// Paths are /approvals/<id>/approve or /approvals/<id>/reject.
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, approvalsPath+"/"), "/")
+		if len(parts) != 2 || (parts[1] != "approve" && parts[1] != "reject") {
+			http.NotFound(w, r)
+			return
+		}
+		if err := q.Decide(parts[0], parts[1] == "approve"); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s := &AdminServer{
+		srv: &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}
+	go func() {
+		if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("serving admin socket: %s", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// listenPrivate listens on a unix socket that is created without permissions for
+// group and others, so it isn't reachable by other users before it's chmod'ed.
+// The umask is process-wide, but it's only narrowed while the socket is created.
+func listenPrivate(socketPath string) (net.Listener, error) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+	return net.Listen("unix", socketPath)
+}
+
+// Close stops serving the admin socket.
+func (s *AdminServer) Close() error {
+	if err := s.srv.Close(); err != nil {
+		return fmt.Errorf("closing admin server: %s", err)
+	}
+	return nil
+}
+
+// Client talks with the admin socket of a running daemon.
+type Client struct {
+	c *http.Client
+}
+
+// NewClient returns a client for the admin socket in socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{
+		c: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// List returns the requests waiting for approval.
+func (c *Client) List(ctx context.Context) ([]Request, error) {
+	res, err := c.do(ctx, http.MethodGet, approvalsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	var reqs []Request
+	if err := json.NewDecoder(res.Body).Decode(&reqs); err != nil {
+		return nil, fmt.Errorf("decoding pending approvals: %s", err)
+	}
+	return reqs, nil
+}
+
+// Approve approves the pending request with the provided id.
+func (c *Client) Approve(ctx context.Context, id string) error {
+	return c.decide(ctx, id, "approve")
+}
+
+// Reject rejects the pending request with the provided id.
+func (c *Client) Reject(ctx context.Context, id string) error {
+	return c.decide(ctx, id, "reject")
+}
+
+func (c *Client) decide(ctx context.Context, id, decision string) error {
+	res, err := c.do(ctx, http.MethodPost, approvalsPath+"/"+id+"/"+decision)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string) (*http.Response, error) {
+	// The host is ignored, since the transport always dials the admin socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://admin"+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %s", err)
+	}
+	res, err := c.c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling admin socket (is the daemon running?): %s", err)
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		defer func() { _ = res.Body.Close() }()
+		msg, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("admin socket replied %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return res, nil
+}
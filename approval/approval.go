@@ -0,0 +1,183 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/google/uuid"
+	"github.com/textileio/go-auctions-client/internal/addrkey"
+	logger "github.com/textileio/go-log/v2"
+)
+
+var (
+	log = logger.Logger("approval")
+
+	errRejected = errors.New("rejected by operator")
+	errTimedOut = errors.New("approval timed out")
+	errNotFound = errors.New("pending request not found")
+)
+
+// Config is the user-facing configuration of manual approvals for a wallet address.
+type Config struct {
+	// Threshold is the deal cost in attoFIL above which proposals require manual approval.
+	Threshold string `mapstructure:"threshold"`
+}
+
+// Request is a deal proposal waiting for manual approval.
+type Request struct {
+	ID            string    `json:"id"`
+	ReceivedAt    time.Time `json:"received_at"`
+	WalletAddress string    `json:"wallet_address"`
+	Provider      string    `json:"provider"`
+	PieceCID      string    `json:"piece_cid"`
+	PieceSize     uint64    `json:"piece_size"`
+	Duration      int64     `json:"duration"`
+	// Cost is the total storage fee plus client collateral in attoFIL.
+	Cost string `json:"cost"`
+}
+
+type pendingRequest struct {
+	req      Request
+	decision chan bool
+}
+
+// Queue holds deal proposals whose cost exceeds the configured threshold of
+// their wallet address until an operator approves or rejects them.
+type Queue struct {
+	lock       sync.Mutex
+	thresholds map[address.Address]abi.TokenAmount
+	pending    map[string]*pendingRequest
+}
+
+// New returns a new approval queue with thresholds configured by wallet address.
+// Proposals for addresses without a threshold don't require approval.
+func New(cfgs map[string]Config) (*Queue, error) {
+	thresholds, err := newThresholds(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{
+		thresholds: thresholds,
+		pending:    map[string]*pendingRequest{},
+	}, nil
+}
+
+// Update replaces the configured thresholds. If the new configuration is invalid,
+// the current thresholds are kept. Pending requests aren't affected.
+func (q *Queue) Update(cfgs map[string]Config) error {
+	thresholds, err := newThresholds(cfgs)
+	if err != nil {
+		return err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.thresholds = thresholds
+
+	return nil
+}
+
+// AwaitApproval returns immediately if the proposal doesn't require approval. Otherwise,
+// it holds the proposal as pending until an operator decides, or ctx is done.
+func (q *Queue) AwaitApproval(ctx context.Context, proposal market.DealProposal) error {
+	cost := big.Add(proposal.TotalStorageFee(), proposal.ClientCollateral)
+
+	q.lock.Lock()
+	threshold, ok := q.thresholds[proposal.Client]
+	if !ok || !cost.GreaterThan(threshold) {
+		q.lock.Unlock()
+		return nil
+	}
+	p := &pendingRequest{
+		req: Request{
+			ID:            uuid.New().String(),
+			ReceivedAt:    time.Now(),
+			WalletAddress: proposal.Client.String(),
+			Provider:      proposal.Provider.String(),
+			PieceCID:      proposal.PieceCID.String(),
+			PieceSize:     uint64(proposal.PieceSize),
+			Duration:      int64(proposal.Duration()),
+			Cost:          cost.String(),
+		},
+		decision: make(chan bool, 1),
+	}
+	q.pending[p.req.ID] = p
+	q.lock.Unlock()
+	log.Infof("deal proposal %s with cost %s attoFIL is waiting for approval", p.req.ID, cost)
+
+	var approved bool
+	select {
+	case approved = <-p.decision:
+	case <-ctx.Done():
+		q.lock.Lock()
+		_, stillPending := q.pending[p.req.ID]
+		delete(q.pending, p.req.ID)
+		q.lock.Unlock()
+		if stillPending {
+			log.Warnf("deal proposal %s approval timed out", p.req.ID)
+			return errTimedOut
+		}
+		// The operator decided right before the timeout.
+		approved = <-p.decision
+	}
+	if !approved {
+		return errRejected
+	}
+	return nil
+}
+
+// Pending returns the requests waiting for approval, oldest first.
+func (q *Queue) Pending() []Request {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	res := make([]Request, 0, len(q.pending))
+	for _, p := range q.pending {
+		res = append(res, p.req)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ReceivedAt.Before(res[j].ReceivedAt) })
+
+	return res
+}
+
+// Decide approves or rejects a pending request.
+func (q *Queue) Decide(id string, approve bool) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	p, ok := q.pending[id]
+	if !ok {
+		return errNotFound
+	}
+	delete(q.pending, id)
+	p.decision <- approve
+	log.Infof("deal proposal %s decided by operator (approved: %t)", id, approve)
+
+	return nil
+}
+
+func newThresholds(cfgs map[string]Config) (map[address.Address]abi.TokenAmount, error) {
+	thresholds := make(map[address.Address]abi.TokenAmount, len(cfgs))
+	for a, cfg := range cfgs {
+		addr, err := addrkey.Parse(a)
+		if err != nil {
+			return nil, err
+		}
+		threshold, err := big.FromString(cfg.Threshold)
+		if err != nil {
+			return nil, fmt.Errorf("parsing approval threshold of %s: %s", addr, err)
+		}
+		if threshold.LessThan(big.Zero()) {
+			return nil, fmt.Errorf("approval threshold of %s is negative", addr)
+		}
+		thresholds[addr] = threshold
+	}
+	return thresholds, nil
+}
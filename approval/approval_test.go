@@ -0,0 +1,136 @@
+package approval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAwaitApproval(t *testing.T) {
+	t.Parallel()
+
+	addr := newProposal(t, 1000, 0).Client.String()
+	q, err := New(map[string]Config{addr: {Threshold: "1000"}})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Cheap proposals and unconfigured addresses don't require approval.
+	require.NoError(t, q.AwaitApproval(ctx, newProposal(t, 1000, 1000)))
+	require.NoError(t, q.AwaitApproval(ctx, newProposal(t, 1001, 5000)))
+
+	decide := func(approve bool) {
+		require.Eventually(t, func() bool { return len(q.Pending()) == 1 }, time.Second, 10*time.Millisecond)
+		pending := q.Pending()[0]
+		require.Equal(t, addr, pending.WalletAddress)
+		require.Equal(t, "5000", pending.Cost)
+		require.NoError(t, q.Decide(pending.ID, approve))
+		require.ErrorIs(t, q.Decide(pending.ID, approve), errNotFound)
+	}
+
+	go decide(true)
+	require.NoError(t, q.AwaitApproval(ctx, newProposal(t, 1000, 5000)))
+
+	go decide(false)
+	require.ErrorIs(t, q.AwaitApproval(ctx, newProposal(t, 1000, 5000)), errRejected)
+
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.AwaitApproval(ctx, newProposal(t, 1000, 5000)), errTimedOut)
+	require.Empty(t, q.Pending())
+}
+
+func TestAdminServer(t *testing.T) {
+	t.Parallel()
+
+	addr := newProposal(t, 1000, 0).Client.String()
+	q, err := New(map[string]Config{addr: {Threshold: "0"}})
+	require.NoError(t, err)
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+	s, err := NewAdminServer(socketPath, q)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	fi, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	ctx := context.Background()
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { results <- q.AwaitApproval(ctx, newProposal(t, 1000, 10)) }()
+	}
+
+	c := NewClient(socketPath)
+	var reqs []Request
+	require.Eventually(t, func() bool {
+		reqs, err = c.List(ctx)
+		require.NoError(t, err)
+		return len(reqs) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, c.Approve(ctx, reqs[0].ID))
+	require.NoError(t, c.Reject(ctx, reqs[1].ID))
+	require.Error(t, c.Approve(ctx, "unknown"))
+
+	var errs []error
+	for i := 0; i < 2; i++ {
+		errs = append(errs, <-results)
+	}
+	require.Contains(t, errs, nil)
+	require.Contains(t, errs, errRejected)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(map[string]Config{"f01000": {Threshold: "notanumber"}})
+	require.Error(t, err)
+	_, err = New(map[string]Config{"f01000": {Threshold: "-1"}})
+	require.Error(t, err)
+	_, err = New(map[string]Config{"notanaddress": {Threshold: "1000"}})
+	require.Error(t, err)
+}
+
+// TestNetworkPrefix isn't parallel, since it changes the current network.
+func TestNetworkPrefix(t *testing.T) {
+	defer func(n address.Network) { address.CurrentNetwork = n }(address.CurrentNetwork)
+	address.CurrentNetwork = address.Testnet
+
+	// A threshold configured with the mainnet prefix applies to calibration proposals.
+	proposal := newProposal(t, 1000, 5000)
+	q, err := New(map[string]Config{address.MainnetPrefix + proposal.Client.String()[1:]: {Threshold: "1000"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.AwaitApproval(ctx, proposal), errTimedOut)
+}
+
+// newProposal returns a proposal for a single epoch, so its total cost is cost.
+func newProposal(t *testing.T, clientID uint64, cost int64) market.DealProposal {
+	client, err := address.NewIDAddress(clientID)
+	require.NoError(t, err)
+	provider, err := address.NewIDAddress(2000)
+	require.NoError(t, err)
+	pieceCid, err := cid.Decode("bafyreifydfjfbkcszmeyz72zu66an2lc4glykhrjlq7r7ir75mplwpqoxu")
+	require.NoError(t, err)
+
+	return market.DealProposal{
+		PieceCID:             pieceCid,
+		PieceSize:            abi.PaddedPieceSize(1024),
+		Client:               client,
+		Provider:             provider,
+		StartEpoch:           100,
+		EndEpoch:             101,
+		StoragePricePerEpoch: big.NewInt(cost),
+		ProviderCollateral:   big.Zero(),
+		ClientCollateral:     big.Zero(),
+	}
+}
@@ -0,0 +1,320 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/textileio/go-auctions-client/internal/addrkey"
+	"github.com/textileio/go-auctions-client/propsigner"
+	logger "github.com/textileio/go-log/v2"
+)
+
+var (
+	log = logger.Logger("audit")
+)
+
+const (
+	// OutcomeSigned is the outcome of requests that were signed.
+	OutcomeSigned = "signed"
+	// OutcomeFailed is the outcome of requests that weren't signed.
+	OutcomeFailed = "failed"
+
+	maxLineSize = 1 << 20 // 1MiB
+)
+
+// Entry is a signing request recorded in the audit log.
+type Entry struct {
+	Time                 time.Time `json:"time"`
+	RemotePeer           string    `json:"remote_peer"`
+	ConnectionPath       string    `json:"connection_path,omitempty"`
+	TokenName            string    `json:"token_name,omitempty"`
+	WalletAddress        string    `json:"wallet_address"`
+	FilecoinDealProtocol string    `json:"filecoin_deal_protocol"`
+	Proposal             *Proposal `json:"proposal,omitempty"`
+	DealStatusRequest    string    `json:"deal_status_request,omitempty"`
+	Outcome              string    `json:"outcome"`
+	Error                string    `json:"error,omitempty"`
+	Signature            []byte    `json:"signature,omitempty"`
+}
+
+// Proposal contains the decoded fields of a deal proposal.
+type Proposal struct {
+	PieceCID             string `json:"piece_cid"`
+	PieceSize            uint64 `json:"piece_size"`
+	VerifiedDeal         bool   `json:"verified_deal"`
+	Client               string `json:"client"`
+	Provider             string `json:"provider"`
+	Label                string `json:"label"`
+	LabelBytes           []byte `json:"label_bytes,omitempty"`
+	StartEpoch           int64  `json:"start_epoch"`
+	EndEpoch             int64  `json:"end_epoch"`
+	StoragePricePerEpoch string `json:"storage_price_per_epoch"`
+	ProviderCollateral   string `json:"provider_collateral"`
+	ClientCollateral     string `json:"client_collateral"`
+}
+
+// record is a line of the audit log. Hash is the hex-encoded SHA-256 of PrevHash
+// concatenated with the raw Entry bytes, which chains every record with the previous one.
+type record struct {
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+	Entry    json.RawMessage `json:"entry"`
+}
+
+// Log is an append-only and hash-chained audit log of signing requests.
+type Log struct {
+	lock     sync.Mutex
+	f        *os.File
+	lastHash string
+}
+
+var _ propsigner.AuditLog = (*Log)(nil)
+
+// Open opens the audit log in path, creating it if doesn't exist. A last record
+// torn by a crash while it was written is truncated.
+func Open(path string) (*Log, error) {
+	var lastHash string
+	size, err := scan(path, func(_ int, r record) error {
+		lastHash = r.Hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading audit log: %s", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %s", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("getting audit log size: %s", err)
+	}
+	if fi.Size() > size {
+		log.Warnf("truncating torn last record of audit log (%d bytes)", fi.Size()-size)
+		if err := f.Truncate(size); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("truncating torn record: %s", err)
+		}
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("syncing audit log: %s", err)
+		}
+	}
+	// Logging the head hash anchors the chain outside of the file, so truncating it
+	// or rebuilding it can be detected by comparing with the head printed by Verify.
+	log.Infof("audit log head hash is %q", lastHash)
+	return &Log{
+		f:        f,
+		lastHash: lastHash,
+	}, nil
+}
+
+// Record appends a signing request to the audit log.
+func (l *Log) Record(ev propsigner.SigningEvent) error {
+	e := Entry{
+		Time:                 ev.Time.UTC(),
+		RemotePeer:           ev.RemotePeer.String(),
+		ConnectionPath:       string(ev.ConnectionPath),
+		TokenName:            ev.TokenName,
+		WalletAddress:        ev.WalletAddress,
+		FilecoinDealProtocol: ev.FilecoinDealProtocol,
+		DealStatusRequest:    ev.DealStatusRequest,
+		Outcome:              OutcomeSigned,
+	}
+	if p := ev.Proposal; p != nil {
+		e.Proposal = &Proposal{
+			PieceCID:             p.PieceCID.String(),
+			PieceSize:            uint64(p.PieceSize),
+			VerifiedDeal:         p.VerifiedDeal,
+			Client:               p.Client.String(),
+			Provider:             p.Provider.String(),
+			Label:                p.Label,
+			LabelBytes:           ev.LabelBytes,
+			StartEpoch:           int64(p.StartEpoch),
+			EndEpoch:             int64(p.EndEpoch),
+			StoragePricePerEpoch: p.StoragePricePerEpoch.String(),
+			ProviderCollateral:   p.ProviderCollateral.String(),
+			ClientCollateral:     p.ClientCollateral.String(),
+		}
+	}
+	if ev.Err != nil {
+		e.Outcome = OutcomeFailed
+		e.Error = ev.Err.Error()
+	}
+	if ev.Signature != nil {
+		sig, err := ev.Signature.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("marshaling signature: %s", err)
+		}
+		e.Signature = sig
+	}
+	entry, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshaling entry: %s", err)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	r := record{
+		PrevHash: l.lastHash,
+		Hash:     hash(l.lastHash, entry),
+		Entry:    entry,
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshaling record: %s", err)
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing record: %s", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("syncing audit log: %s", err)
+	}
+	l.lastHash = r.Hash
+
+	return nil
+}
+
+// Close closes the audit log.
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if err := l.f.Close(); err != nil {
+		return fmt.Errorf("closing audit log: %s", err)
+	}
+	log.Infof("audit log head hash is %q", l.lastHash)
+	return nil
+}
+
+// Verify checks the hash chain of the audit log in path, and returns the number
+// of verified entries and the hash of the last one. If the chain is broken, it
+// returns an error mentioning the first tampered line. The chain can't reveal
+// removed trailing entries or a rebuilt log, so the head hash should be compared
+// with the one logged by the daemon.
+func Verify(path string) (int, string, error) {
+	var count int
+	var prevHash string
+	_, err := scan(path, func(line int, r record) error {
+		if r.PrevHash != prevHash {
+			return fmt.Errorf("line %d: previous hash %s doesn't match %s", line, r.PrevHash, prevHash)
+		}
+		if h := hash(r.PrevHash, r.Entry); r.Hash != h {
+			return fmt.Errorf("line %d: hash %s doesn't match the entry hash %s", line, r.Hash, h)
+		}
+		prevHash = r.Hash
+		count++
+		return nil
+	})
+	return count, prevHash, err
+}
+
+// Filter selects entries of the audit log. Zero-valued fields don't filter.
+type Filter struct {
+	// Address matches the wallet address of the request.
+	Address string
+	// Provider matches the storage-provider of deal proposals.
+	Provider string
+	// Since matches entries recorded at or after this time.
+	Since time.Time
+	// Until matches entries recorded before this time.
+	Until time.Time
+}
+
+func (f Filter) match(e Entry) bool {
+	if f.Address != "" && !sameAddress(e.WalletAddress, f.Address) {
+		return false
+	}
+	if f.Provider != "" && (e.Proposal == nil || !sameAddress(e.Proposal.Provider, f.Provider)) {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// sameAddress compares parsed addresses. If any of them can't be parsed, they're
+// compared as strings.
+func sameAddress(a, b string) bool {
+	addrA, errA := addrkey.Parse(a)
+	addrB, errB := addrkey.Parse(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return addrA == addrB
+}
+
+// List returns the entries of the audit log in path that match the filter.
+func List(path string, f Filter) ([]Entry, error) {
+	var res []Entry
+	_, err := scan(path, func(line int, r record) error {
+		var e Entry
+		if err := json.Unmarshal(r.Entry, &e); err != nil {
+			return fmt.Errorf("line %d: unmarshaling entry: %s", line, err)
+		}
+		if f.match(e) {
+			res = append(res, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// scan calls fn with every record of the audit log in path, and returns the size of
+// the complete records. A last line without a newline is a record torn by a crash
+// while it was written, so it's skipped.
+func scan(path string, fn func(line int, r record) error) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var size int64
+	r := bufio.NewReaderSize(f, maxLineSize)
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(b) > 0 {
+				log.Warnf("skipping torn record in line %d of audit log", line)
+			}
+			return size, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("line %d: reading: %s", line, err)
+		}
+		var rec record
+		if err := json.Unmarshal(bytes.TrimSpace(b), &rec); err != nil {
+			return 0, fmt.Errorf("line %d: unmarshaling record: %s", line, err)
+		}
+		if err := fn(line, rec); err != nil {
+			return 0, err
+		}
+		size += int64(len(b))
+	}
+}
+
+func hash(prevHash string, entry []byte) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(prevHash))
+	_, _ = h.Write(entry)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+	"github.com/textileio/go-auctions-client/propsigner"
+)
+
+func TestRecordAndVerify(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, l.Record(proposalEvent(t, now.Add(-48*time.Hour), 1000, nil)))
+	bytesLabel := proposalEvent(t, now, 1001, errors.New("rejected by policy"))
+	bytesLabel.Proposal.Label, bytesLabel.LabelBytes = "", []byte{0xff, 0x00, 0x01}
+	require.NoError(t, l.Record(bytesLabel))
+	require.NoError(t, l.Close())
+
+	// Reopening continues the hash chain.
+	l, err = Open(path)
+	require.NoError(t, err)
+	require.NoError(t, l.Record(propsigner.SigningEvent{
+		Time:                 now,
+		WalletAddress:        "f01000",
+		FilecoinDealProtocol: "/fil/storage/status/1.1.0",
+		DealStatusRequest:    "bafyreifydfjfbkcszmeyz72zu66an2lc4glykhrjlq7r7ir75mplwpqoxu",
+		Signature:            &crypto.Signature{Type: crypto.SigTypeSecp256k1, Data: []byte{1, 2, 3}},
+	}))
+	require.NoError(t, l.Close())
+
+	count, head, err := Verify(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	require.Len(t, head, 64)
+
+	entries, err := List(path, Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, OutcomeSigned, entries[0].Outcome)
+	require.Equal(t, OutcomeFailed, entries[1].Outcome)
+	require.Equal(t, "rejected by policy", entries[1].Error)
+	require.Equal(t, "label", entries[0].Proposal.Label)
+	require.Nil(t, entries[0].Proposal.LabelBytes)
+	require.Empty(t, entries[1].Proposal.Label)
+	require.Equal(t, []byte{0xff, 0x00, 0x01}, entries[1].Proposal.LabelBytes)
+
+	entries, err = List(path, Filter{Provider: "f01001"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "f01001", entries[0].Proposal.Provider)
+
+	entries, err = List(path, Filter{Since: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	entries, err = List(path, Filter{Address: "f01000", Until: now.Add(-time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "f01000", entries[0].Proposal.Provider)
+
+	// Addresses match regardless of the network prefix.
+	entries, err = List(path, Filter{Address: "t01000", Provider: "t01001"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "f01001", entries[0].Proposal.Provider)
+}
+
+func TestTampering(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Record(proposalEvent(t, time.Now(), 1000, nil)))
+	}
+	require.NoError(t, l.Close())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Modifying an entry breaks its hash.
+	tampered := strings.Replace(string(content), `"provider":"f01000"`, `"provider":"f09999"`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(tampered), 0600))
+	_, _, err = Verify(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 1")
+
+	// Removing an entry breaks the chain.
+	lines := strings.SplitAfter(string(content), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+lines[2]), 0600))
+	_, _, err = Verify(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 2")
+
+	// Removing the last entry keeps the chain valid, but changes the head hash.
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	_, head, err := Verify(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+lines[1]), 0600))
+	count, truncatedHead, err := Verify(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.NotEqual(t, head, truncatedHead)
+}
+
+func TestTornRecord(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Record(proposalEvent(t, time.Now(), 1000, nil)))
+	}
+	require.NoError(t, l.Close())
+
+	// A crash while writing the last record leaves it without a newline.
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(content), "\n")
+	complete := lines[0] + lines[1]
+	torn := complete + lines[2][:len(lines[2])/2]
+	require.NoError(t, os.WriteFile(path, []byte(torn), 0600))
+
+	count, _, err := Verify(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	entries, err := List(path, Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// Reopening truncates the torn record and continues the chain.
+	l, err = Open(path)
+	require.NoError(t, err)
+	content, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, complete, string(content))
+	require.NoError(t, l.Record(proposalEvent(t, time.Now(), 1000, nil)))
+	require.NoError(t, l.Close())
+	count, _, err = Verify(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+}
+
+func proposalEvent(t *testing.T, ts time.Time, providerID uint64, signErr error) propsigner.SigningEvent {
+	client, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	provider, err := address.NewIDAddress(providerID)
+	require.NoError(t, err)
+	pieceCid, err := cid.Decode("bafyreifydfjfbkcszmeyz72zu66an2lc4glykhrjlq7r7ir75mplwpqoxu")
+	require.NoError(t, err)
+
+	ev := propsigner.SigningEvent{
+		Time:                 ts,
+		RemotePeer:           peer.ID("fakepeer"),
+		WalletAddress:        client.String(),
+		FilecoinDealProtocol: "/fil/storage/mk/1.1.0",
+		Proposal: &market.DealProposal{
+			PieceCID:             pieceCid,
+			PieceSize:            1024,
+			Client:               client,
+			Provider:             provider,
+			Label:                "label",
+			StartEpoch:           100,
+			EndEpoch:             200,
+			StoragePricePerEpoch: big.NewInt(10),
+			ProviderCollateral:   big.Zero(),
+			ClientCollateral:     big.Zero(),
+		},
+		Err: signErr,
+	}
+	if signErr == nil {
+		ev.Signature = &crypto.Signature{Type: crypto.SigTypeBLS, Data: []byte{4, 5, 6}}
+	}
+	return ev
+}
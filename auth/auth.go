@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/textileio/go-auctions-client/internal/addrkey"
+)
+
+var (
+	errUnknownToken = errors.New("unknown token")
+)
+
+// Config is the user-facing configuration of a named auth token.
+type Config struct {
+	// Token is the secret value sent in signing requests.
+	Token string `mapstructure:"token"`
+	// Addresses are the wallet addresses that the token can request signatures for.
+	// If empty, all wallet addresses are allowed.
+	Addresses []string `mapstructure:"addresses"`
+	// Scopes are the kinds of signing requests allowed for the token (e.g: "proposal" or "status").
+	// If empty, all kinds are allowed.
+	Scopes []string `mapstructure:"scopes"`
+	// ExpiresAt is an optional RFC3339 date after which the token isn't valid.
+	ExpiresAt string `mapstructure:"expires-at"`
+	// Revoked disables the token.
+	Revoked bool `mapstructure:"revoked"`
+}
+
+type token struct {
+	name      string
+	secret    string
+	hash      [sha256.Size]byte
+	addresses map[address.Address]struct{}
+	scopes    map[string]struct{}
+	expiresAt time.Time
+	revoked   bool
+}
+
+// Tokens authorizes signing requests with a set of named and scoped auth tokens.
+type Tokens struct {
+	lock   sync.RWMutex
+	tokens []token
+}
+
+// New returns a new set of auth tokens configured by name.
+func New(cfgs map[string]Config) (*Tokens, error) {
+	tokens, err := newTokens(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		tokens: tokens,
+	}, nil
+}
+
+// Update replaces the configured tokens, which allows revoking them without restarting.
+// If the new configuration is invalid, the current tokens are kept.
+func (t *Tokens) Update(cfgs map[string]Config) error {
+	tokens, err := newTokens(cfgs)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.tokens = tokens
+
+	return nil
+}
+
+// Authorize returns the name of the token if it's allowed to request signatures
+// for walletAddr with the provided scope.
+func (t *Tokens) Authorize(tokenValue, walletAddr, scope string) (string, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	// Compare against every token without returning early, so the
+	// timing doesn't leak which or how many tokens were compared.
+	h := sha256.Sum256([]byte(tokenValue))
+	match := -1
+	for i := range t.tokens {
+		if subtle.ConstantTimeCompare(h[:], t.tokens[i].hash[:]) == 1 {
+			match = i
+		}
+	}
+	return t.authorize(match, walletAddr, scope)
+}
+
+// AuthorizeChallenge is like Authorize, but the token isn't known. verify reports if
+// the request was authenticated with a token value, and is called for every token.
+func (t *Tokens) AuthorizeChallenge(verify func(token string) bool, walletAddr, scope string) (string, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	// As in Authorize, every token is verified so the timing doesn't leak which one matched.
+	match := -1
+	for i := range t.tokens {
+		if verify(t.tokens[i].secret) {
+			match = i
+		}
+	}
+	return t.authorize(match, walletAddr, scope)
+}
+
+func (t *Tokens) authorize(match int, walletAddr, scope string) (string, error) {
+	if match == -1 {
+		return "", errUnknownToken
+	}
+
+	tk := t.tokens[match]
+	if tk.revoked {
+		return "", fmt.Errorf("token %s is revoked", tk.name)
+	}
+	if !tk.expiresAt.IsZero() && time.Now().After(tk.expiresAt) {
+		return "", fmt.Errorf("token %s expired at %s", tk.name, tk.expiresAt.Format(time.RFC3339))
+	}
+	if tk.addresses != nil {
+		addr, err := addrkey.Parse(walletAddr)
+		if _, ok := tk.addresses[addr]; err != nil || !ok {
+			return "", fmt.Errorf("token %s isn't allowed for wallet address %s", tk.name, walletAddr)
+		}
+	}
+	if _, ok := tk.scopes[scope]; tk.scopes != nil && !ok {
+		return "", fmt.Errorf("token %s isn't allowed for %q requests", tk.name, scope)
+	}
+
+	return tk.name, nil
+}
+
+func newTokens(cfgs map[string]Config) ([]token, error) {
+	tokens := make([]token, 0, len(cfgs))
+	seen := make(map[[sha256.Size]byte]string, len(cfgs))
+	for name, cfg := range cfgs {
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("token %s is empty", name)
+		}
+		addresses, err := addrkey.ParseSet(cfg.Addresses)
+		if err != nil {
+			return nil, fmt.Errorf("parsing addresses of token %s: %s", name, err)
+		}
+		tk := token{
+			name:      name,
+			secret:    cfg.Token,
+			hash:      sha256.Sum256([]byte(cfg.Token)),
+			addresses: addresses,
+			scopes:    toSet(cfg.Scopes),
+			revoked:   cfg.Revoked,
+		}
+		if other, ok := seen[tk.hash]; ok {
+			return nil, fmt.Errorf("tokens %s and %s have the same value", name, other)
+		}
+		seen[tk.hash] = name
+		if cfg.ExpiresAt != "" {
+			expiresAt, err := time.Parse(time.RFC3339, cfg.ExpiresAt)
+			if err != nil {
+				return nil, fmt.Errorf("parsing expiration of token %s: %s", name, err)
+			}
+			tk.expiresAt = expiresAt
+		}
+		tokens = append(tokens, tk)
+	}
+	return tokens, nil
+}
+
+func toSet(vals []string) map[string]struct{} {
+	if len(vals) == 0 {
+		return nil
+	}
+	res := make(map[string]struct{}, len(vals))
+	for _, v := range vals {
+		res[v] = struct{}{}
+	}
+	return res
+}
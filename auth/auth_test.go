@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := New(map[string]Config{
+		"unrestricted": {Token: "token1"},
+		"scoped": {
+			Token:     "token2",
+			Addresses: []string{"f01000"},
+			Scopes:    []string{"status"},
+		},
+		"expired": {Token: "token3", ExpiresAt: time.Now().Add(-time.Hour).Format(time.RFC3339)},
+		"revoked": {Token: "token4", Revoked: true},
+	})
+	require.NoError(t, err)
+
+	name, err := tokens.Authorize("token1", "f01000", "proposal")
+	require.NoError(t, err)
+	require.Equal(t, "unrestricted", name)
+
+	name, err = tokens.Authorize("token2", "f01000", "status")
+	require.NoError(t, err)
+	require.Equal(t, "scoped", name)
+	// Wallet addresses match regardless of the network prefix.
+	name, err = tokens.Authorize("token2", "t01000", "status")
+	require.NoError(t, err)
+	require.Equal(t, "scoped", name)
+
+	_, err = tokens.Authorize("token2", "notanaddress", "status")
+	require.Error(t, err)
+	_, err = tokens.Authorize("token2", "f01001", "status")
+	require.Error(t, err)
+	_, err = tokens.Authorize("token2", "f01000", "proposal")
+	require.Error(t, err)
+	_, err = tokens.Authorize("token3", "f01000", "proposal")
+	require.Error(t, err)
+	_, err = tokens.Authorize("token4", "f01000", "proposal")
+	require.Error(t, err)
+	_, err = tokens.Authorize("unknown", "f01000", "proposal")
+	require.ErrorIs(t, err, errUnknownToken)
+}
+
+func TestAuthorizeChallenge(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := New(map[string]Config{
+		"backend-a": {Token: "token1"},
+		"backend-b": {Token: "token2", Scopes: []string{"status"}},
+	})
+	require.NoError(t, err)
+
+	verifyWith := func(value string) func(string) bool {
+		return func(token string) bool { return token == value }
+	}
+	name, err := tokens.AuthorizeChallenge(verifyWith("token1"), "f01000", "proposal")
+	require.NoError(t, err)
+	require.Equal(t, "backend-a", name)
+
+	_, err = tokens.AuthorizeChallenge(verifyWith("token2"), "f01000", "proposal")
+	require.Error(t, err)
+	_, err = tokens.AuthorizeChallenge(verifyWith("unknown"), "f01000", "proposal")
+	require.ErrorIs(t, err, errUnknownToken)
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+
+	tokens, err := New(map[string]Config{"backend": {Token: "token1"}})
+	require.NoError(t, err)
+	_, err = tokens.Authorize("token1", "f01000", "proposal")
+	require.NoError(t, err)
+
+	err = tokens.Update(map[string]Config{"backend": {Token: "token1", Revoked: true}})
+	require.NoError(t, err)
+	_, err = tokens.Authorize("token1", "f01000", "proposal")
+	require.Error(t, err)
+
+	// Invalid configurations keep the current tokens.
+	err = tokens.Update(map[string]Config{"backend": {Token: ""}})
+	require.Error(t, err)
+	_, err = tokens.Authorize("token1", "f01000", "proposal")
+	require.Error(t, err)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(map[string]Config{"a": {Token: ""}})
+	require.Error(t, err)
+	_, err = New(map[string]Config{"a": {Token: "t", ExpiresAt: "tomorrow"}})
+	require.Error(t, err)
+	_, err = New(map[string]Config{"a": {Token: "t"}, "b": {Token: "t"}})
+	require.Error(t, err)
+	_, err = New(map[string]Config{"a": {Token: "t", Addresses: []string{"notanaddress"}}})
+	require.Error(t, err)
+}
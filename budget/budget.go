@@ -0,0 +1,257 @@
+package budget
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/textileio/go-auctions-client/internal/addrkey"
+	logger "github.com/textileio/go-log/v2"
+)
+
+var (
+	log = logger.Logger("budget")
+)
+
+// Config is the user-facing configuration of the budget of a wallet address.
+type Config struct {
+	// Amount is the maximum amount of attoFIL that can be spent in the window.
+	Amount string `mapstructure:"amount"`
+	// Window is the duration of the rolling window in which spending is summed.
+	Window time.Duration `mapstructure:"window"`
+}
+
+// Status describes the current spending of a wallet address.
+type Status struct {
+	Address string
+	Spent   abi.TokenAmount
+	Budget  abi.TokenAmount
+	Window  time.Duration
+}
+
+type limit struct {
+	amount abi.TokenAmount
+	window time.Duration
+}
+
+type entry struct {
+	Time    time.Time       `json:"time"`
+	Address string          `json:"address"`
+	Amount  abi.TokenAmount `json:"amount"`
+}
+
+// Tracker keeps a persistent ledger of the cost of signed deal proposals, and
+// refuses to reserve new spending if the configured budget of a wallet address
+// is exceeded in the rolling window.
+type Tracker struct {
+	lock    sync.Mutex
+	ledger  *os.File
+	limits  map[address.Address]limit
+	entries map[address.Address][]entry
+	pending map[address.Address]abi.TokenAmount
+}
+
+// New returns a new budget tracker that persists the ledger in ledgerPath.
+// Addresses without a configured budget aren't limited, but their spending is
+// still recorded in the ledger.
+func New(ledgerPath string, cfgs map[string]Config) (*Tracker, error) {
+	limits, err := newLimits(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadLedger(ledgerPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading ledger: %s", err)
+	}
+	f, err := os.OpenFile(ledgerPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening ledger: %s", err)
+	}
+
+	return &Tracker{
+		ledger:  f,
+		limits:  limits,
+		entries: entries,
+		pending: map[address.Address]abi.TokenAmount{},
+	}, nil
+}
+
+// Update replaces the configured budgets. If the new configuration is invalid,
+// the current budgets are kept.
+func (t *Tracker) Update(cfgs map[string]Config) error {
+	limits, err := newLimits(cfgs)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.limits = limits
+
+	return nil
+}
+
+// Reserve reserves the total cost of the deal proposal from the budget of the
+// client address. It returns an error if the reservation would exceed the budget.
+// The returned function must be called with true if the proposal was signed, which
+// records the spending in the ledger, or false to release the reservation.
+func (t *Tracker) Reserve(proposal market.DealProposal) (func(signed bool), error) {
+	addr := proposal.Client
+	cost := big.Add(proposal.TotalStorageFee(), proposal.ClientCollateral)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if l, ok := t.limits[addr]; ok {
+		spent := big.Add(t.spent(addr, l.window), t.pendingOf(addr))
+		if total := big.Add(spent, cost); total.GreaterThan(l.amount) {
+			return nil, fmt.Errorf("deal cost %s plus spent %s exceeds budget %s for the last %s",
+				cost, spent, l.amount, l.window)
+		}
+	}
+	t.pending[addr] = big.Add(t.pendingOf(addr), cost)
+
+	var once sync.Once
+	return func(signed bool) {
+		once.Do(func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.pending[addr] = big.Sub(t.pending[addr], cost)
+			if !signed {
+				return
+			}
+			e := entry{Time: time.Now(), Address: addr.String(), Amount: cost}
+			t.entries[addr] = append(t.entries[addr], e)
+			if err := t.persist(e); err != nil {
+				log.Errorf("persisting spending of %s in ledger: %s", addr, err)
+			}
+		})
+	}, nil
+}
+
+// Status returns the current spending of every wallet address with a configured budget.
+func (t *Tracker) Status() []Status {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	res := make([]Status, 0, len(t.limits))
+	for addr, l := range t.limits {
+		res = append(res, Status{
+			Address: addr.String(),
+			Spent:   t.spent(addr, l.window),
+			Budget:  l.amount,
+			Window:  l.window,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+
+	return res
+}
+
+// Close closes the ledger.
+func (t *Tracker) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if err := t.ledger.Close(); err != nil {
+		return fmt.Errorf("closing ledger: %s", err)
+	}
+	return nil
+}
+
+func (t *Tracker) spent(addr address.Address, window time.Duration) abi.TokenAmount {
+	since := time.Now().Add(-window)
+	total := big.Zero()
+	for _, e := range t.entries[addr] {
+		if e.Time.After(since) {
+			total = big.Add(total, e.Amount)
+		}
+	}
+	return total
+}
+
+func (t *Tracker) pendingOf(addr address.Address) abi.TokenAmount {
+	if p, ok := t.pending[addr]; ok {
+		return p
+	}
+	return big.Zero()
+}
+
+func (t *Tracker) persist(e entry) error {
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return fmt.Errorf("marshaling ledger entry: %s", err)
+	}
+	if _, err := t.ledger.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing ledger entry: %s", err)
+	}
+	if err := t.ledger.Sync(); err != nil {
+		return fmt.Errorf("syncing ledger: %s", err)
+	}
+	return nil
+}
+
+// loadLedger returns the ledger entries by parsed address, since they might have been
+// recorded with another network prefix.
+func loadLedger(path string) (map[address.Address][]entry, error) {
+	entries := map[address.Address][]entry{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Errorf("closing ledger: %s", err)
+		}
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("unmarshaling entry in line %d: %s", line, err)
+		}
+		addr, err := addrkey.Parse(e.Address)
+		if err != nil {
+			return nil, fmt.Errorf("entry in line %d: %s", line, err)
+		}
+		entries[addr] = append(entries[addr], e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading ledger: %s", err)
+	}
+
+	return entries, nil
+}
+
+func newLimits(cfgs map[string]Config) (map[address.Address]limit, error) {
+	limits := make(map[address.Address]limit, len(cfgs))
+	for a, cfg := range cfgs {
+		addr, err := addrkey.Parse(a)
+		if err != nil {
+			return nil, err
+		}
+		amount, err := big.FromString(cfg.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("parsing budget amount of %s: %s", addr, err)
+		}
+		if amount.Sign() < 0 {
+			return nil, fmt.Errorf("budget amount of %s can't be negative", addr)
+		}
+		if cfg.Window <= 0 {
+			return nil, fmt.Errorf("budget window of %s must be positive", addr)
+		}
+		limits[addr] = limit{amount: amount, window: cfg.Window}
+	}
+	return limits, nil
+}
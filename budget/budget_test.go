@@ -0,0 +1,142 @@
+package budget
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+
+	proposal := proposalWithCost(t, 40)
+	ledgerPath := filepath.Join(t.TempDir(), "budget.ledger")
+	cfgs := map[string]Config{
+		proposal.Client.String(): {Amount: "100", Window: time.Hour},
+	}
+	tracker, err := New(ledgerPath, cfgs)
+	require.NoError(t, err)
+
+	settle1, err := tracker.Reserve(proposal)
+	require.NoError(t, err)
+	settle2, err := tracker.Reserve(proposal)
+	require.NoError(t, err)
+
+	// Pending reservations count against the budget.
+	_, err = tracker.Reserve(proposal)
+	require.Error(t, err)
+
+	// A released reservation frees the budget.
+	settle2(false)
+	settle3, err := tracker.Reserve(proposal)
+	require.NoError(t, err)
+
+	settle1(true)
+	settle3(true)
+	_, err = tracker.Reserve(proposal)
+	require.Error(t, err)
+	require.Equal(t, "80", tracker.Status()[0].Spent.String())
+	require.NoError(t, tracker.Close())
+
+	// The spending is persisted across restarts.
+	tracker, err = New(ledgerPath, cfgs)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tracker.Close()) }()
+	statuses := tracker.Status()
+	require.Len(t, statuses, 1)
+	require.Equal(t, "80", statuses[0].Spent.String())
+	require.Equal(t, "100", statuses[0].Budget.String())
+	_, err = tracker.Reserve(proposal)
+	require.Error(t, err)
+
+	// Addresses without a budget aren't limited.
+	err = tracker.Update(map[string]Config{})
+	require.NoError(t, err)
+	_, err = tracker.Reserve(proposal)
+	require.NoError(t, err)
+}
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+
+	proposal := proposalWithCost(t, 60)
+	tracker, err := New(filepath.Join(t.TempDir(), "budget.ledger"), map[string]Config{
+		proposal.Client.String(): {Amount: "100", Window: 100 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tracker.Close()) }()
+
+	settle, err := tracker.Reserve(proposal)
+	require.NoError(t, err)
+	settle(true)
+	_, err = tracker.Reserve(proposal)
+	require.Error(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	_, err = tracker.Reserve(proposal)
+	require.NoError(t, err)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "budget.ledger")
+	_, err := New(path, map[string]Config{"f01000": {Amount: "invalid", Window: time.Hour}})
+	require.Error(t, err)
+	_, err = New(path, map[string]Config{"f01000": {Amount: "100"}})
+	require.Error(t, err)
+	_, err = New(path, map[string]Config{"notanaddress": {Amount: "100", Window: time.Hour}})
+	require.Error(t, err)
+}
+
+// TestNetworkPrefix isn't parallel, since it changes the current network.
+func TestNetworkPrefix(t *testing.T) {
+	defer func(n address.Network) { address.CurrentNetwork = n }(address.CurrentNetwork)
+	address.CurrentNetwork = address.Testnet
+
+	// A budget configured with the mainnet prefix limits calibration proposals, including
+	// the spending recorded in the ledger before a restart.
+	proposal := proposalWithCost(t, 60)
+	ledgerPath := filepath.Join(t.TempDir(), "budget.ledger")
+	cfgs := map[string]Config{
+		address.MainnetPrefix + proposal.Client.String()[1:]: {Amount: "100", Window: time.Hour},
+	}
+	tracker, err := New(ledgerPath, cfgs)
+	require.NoError(t, err)
+	settle, err := tracker.Reserve(proposal)
+	require.NoError(t, err)
+	settle(true)
+	_, err = tracker.Reserve(proposal)
+	require.Error(t, err)
+	require.NoError(t, tracker.Close())
+
+	address.CurrentNetwork = address.Mainnet
+	tracker, err = New(ledgerPath, cfgs)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tracker.Close()) }()
+	_, err = tracker.Reserve(proposal)
+	require.Error(t, err)
+}
+
+// proposalWithCost returns a proposal whose total storage fee plus client collateral is cost.
+func proposalWithCost(t *testing.T, cost int64) market.DealProposal {
+	client, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	provider, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	return market.DealProposal{
+		Client:               client,
+		Provider:             provider,
+		StartEpoch:           100,
+		EndEpoch:             110,
+		StoragePricePerEpoch: big.NewInt(cost / 20),
+		ClientCollateral:     big.NewInt(cost / 2),
+		ProviderCollateral:   big.Zero(),
+	}
+}
@@ -6,26 +6,37 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/multiformats/go-multibase"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/localwallet"
 	logger "github.com/textileio/go-log/v2"
 )
 
+const (
+	networkMainnet     = "mainnet"
+	networkCalibration = "calibration"
+)
+
 var (
 	cliName           = "auc"
 	envPrefix         = strings.ToUpper(cliName)
 	defaultConfigPath = filepath.Join(os.Getenv("HOME"), "."+cliName)
 	log               = logger.Logger(cliName)
 	v                 = viper.New()
+
+	// configPath is the directory where the config file and other daemon state is stored.
+	configPath string
 )
 
 func init() {
 	// Configuration.
-	configPath := os.Getenv("AUC_PATH")
+	configPath = os.Getenv("AUC_PATH")
 	if configPath == "" {
 		configPath = defaultConfigPath
 	}
@@ -41,6 +52,9 @@ func init() {
 		if err := v.ReadInConfig(); err != nil {
 			log.Fatalf("reading config file: %s", err)
 		}
+		if err := setNetwork(v.GetString("network")); err != nil {
+			log.Fatalf("configuring network: %s", err)
+		}
 	})
 
 	// Commands.
@@ -48,24 +62,140 @@ func init() {
 	cli.ConfigureCLI(v, envPrefix, []cli.Flag{
 		{Name: "log-debug", DefValue: false, Description: "Enable debug level log"},
 		{Name: "log-json", DefValue: false, Description: "Enable structured logging"},
+		{
+			Name:        "network",
+			DefValue:    networkMainnet,
+			Description: "Filecoin network used to render addresses (mainnet or calibration)",
+		},
 	}, rootCmd.PersistentFlags())
 
 	walletCmd.AddCommand(walletDaemonCmd)
 	cli.ConfigureCLI(v, envPrefix, []cli.Flag{
+		{
+			Name:        "wallet-backend",
+			DefValue:    walletBackendLocal,
+			Description: "Wallet backend that signs requests (local, external or lotus)",
+		},
 		{Name: "wallet-keys", DefValue: []string{}, Description: "Wallet address keys"},
+		{
+			Name:        "external-wallet-cmd",
+			DefValue:    "",
+			Description: "Executable of the external wallet backend",
+		},
+		{
+			Name:        "external-wallet-args",
+			DefValue:    []string{},
+			Description: "Arguments of the external wallet backend executable",
+		},
+		{
+			Name:        "external-wallet-timeout",
+			DefValue:    30 * time.Second,
+			Description: "Maximum time for the external wallet backend to reply a request",
+		},
+		{
+			Name:        "lotus-api",
+			DefValue:    "",
+			Description: "Lotus API url or multiaddr of the lotus wallet backend (e.g: /ip4/127.0.0.1/tcp/1234/http)",
+		},
+		{Name: "lotus-token", DefValue: "", Description: "Lotus API token with sign permission"},
 		{Name: "auth-token", DefValue: "", Description: "Authorization token to validate signing requests"},
 		{
 			Name:        "relay-maddr",
-			DefValue:    "/ip4/34.105.85.147/tcp/4001/p2p/QmYRDEq8z3Y9hBBAirwMFySuxyCoWwskrD1bxUEYKBiwmU",
-			Description: "Multiaddress of libp2p relay",
+			DefValue:    []string{"/ip4/34.105.85.147/tcp/4001/p2p/QmYRDEq8z3Y9hBBAirwMFySuxyCoWwskrD1bxUEYKBiwmU"},
+			Description: "Multiaddresses of libp2p relays, in order of preference; repeatable",
+		},
+		{
+			Name:        "relay-reservations",
+			DefValue:    2,
+			Description: "Number of relays to keep slot reservations with at once",
+		},
+		{
+			Name:        "relay-reconnect-min-delay",
+			DefValue:    time.Second,
+			Description: "Delay after a failed reconnection with relays, which doubles with each failure",
+		},
+		{
+			Name:        "relay-reconnect-max-delay",
+			DefValue:    5 * time.Minute,
+			Description: "Maximum delay between failed reconnections with relays",
+		},
+		{
+			Name:        "relay-reconnect-alert-attempts",
+			DefValue:    10,
+			Description: "Consecutive failed reconnections with relays before logging an error",
 		},
 		{Name: "listen-maddr", DefValue: "", Description: "Libp2p listen multiaddr"},
+		{
+			Name:        "reachability",
+			DefValue:    reachabilityAuto,
+			Description: "Reachability of the host (auto, public or private); auto detects it with AutoNAT",
+		},
+		{
+			Name:        "autonat-service",
+			DefValue:    false,
+			Description: "Help other peers detect their reachability with AutoNAT",
+		},
+		{
+			Name:        "hole-punching",
+			DefValue:    true,
+			Description: "Upgrade relayed connections to direct ones with hole punching (DCUtR)",
+		},
+		{
+			Name:        "allowed-peers",
+			DefValue:    []string{},
+			Description: "Libp2p peer-ids allowed to request signatures; if empty, any peer is allowed",
+		},
+		{
+			Name:        "max-clock-skew",
+			DefValue:    time.Duration(0),
+			Description: "Maximum clock skew of signing requests timestamps to reject replays; zero disables it",
+		},
+		{
+			Name:        "disable-v1-protocol",
+			DefValue:    false,
+			Description: "Only accept challenge-response authenticated requests, which don't send the auth token",
+		},
+		{
+			Name:        "passphrase-fd",
+			DefValue:    -1,
+			Description: "File descriptor to read the keystore passphrase from; if negative, it's read from env or prompted",
+		},
+		{
+			Name:        "metrics-addr",
+			DefValue:    "",
+			Description: "Address to serve Prometheus metrics in /metrics (e.g: 127.0.0.1:9090); if empty, it's disabled",
+		},
 		{
 			Name:        "private-key",
 			DefValue:    "",
 			Description: "Libp2p private key",
 		},
 	}, walletDaemonCmd.Flags())
+
+	walletCmd.AddCommand(walletBudgetCmd)
+	walletCmd.AddCommand(walletAuditCmd)
+	walletCmd.AddCommand(walletApprovalsCmd)
+	walletCmd.AddCommand(walletKeystoreCmd)
+	walletKeystoreCmd.AddCommand(walletKeystoreCreateCmd)
+	walletKeystoreCreateCmd.Flags().Int("passphrase-fd", -1, "File descriptor to read the keystore passphrase from")
+	walletCmd.AddCommand(walletKeysCmd)
+	walletKeysCmd.AddCommand(walletKeysImportCmd)
+	walletKeysCmd.AddCommand(walletKeysNewCmd)
+	walletKeysCmd.AddCommand(walletKeysListCmd)
+	walletKeysCmd.AddCommand(walletKeysExportCmd)
+	walletKeysCmd.AddCommand(walletKeysRemoveCmd)
+	walletKeysCmd.PersistentFlags().Int("passphrase-fd", -1, "File descriptor to read the keystore passphrase from")
+	walletKeysImportCmd.Flags().String("file", "", "File with the private key to import")
+	walletKeysNewCmd.Flags().String("type", localwallet.KeyTypeSecp256k1, "Key type (bls or secp256k1)")
+	walletApprovalsCmd.AddCommand(walletApprovalsListCmd)
+	walletApprovalsCmd.AddCommand(walletApprovalsApproveCmd)
+	walletApprovalsCmd.AddCommand(walletApprovalsRejectCmd)
+	walletAuditCmd.AddCommand(walletAuditVerifyCmd)
+	walletAuditCmd.AddCommand(walletAuditListCmd)
+	walletAuditListCmd.Flags().String("address", "", "Only list requests for this wallet address")
+	walletAuditListCmd.Flags().String("provider", "", "Only list deal proposals for this storage-provider")
+	walletAuditListCmd.Flags().String("since", "", "Only list requests at or after this date (RFC3339 or YYYY-MM-DD)")
+	walletAuditListCmd.Flags().String("until", "", "Only list requests before this date (RFC3339 or YYYY-MM-DD)")
 }
 
 var rootCmd = &cobra.Command{
@@ -79,6 +209,20 @@ func main() {
 	cli.CheckErr(rootCmd.Execute())
 }
 
+// setNetwork configures the prefix used to render addresses. Addresses with
+// either prefix are accepted regardless of the network.
+func setNetwork(network string) error {
+	switch network {
+	case networkMainnet:
+		address.CurrentNetwork = address.Mainnet
+	case networkCalibration:
+		address.CurrentNetwork = address.Testnet
+	default:
+		return fmt.Errorf("unknown network %q", network)
+	}
+	return nil
+}
+
 func initConfigFile(configPath string) error {
 	path := filepath.Join(configPath, "config")
 	if _, err := os.Stat(path); err == nil {
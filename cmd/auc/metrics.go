@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics exposes the daemon metrics in the /metrics path of addr.
+func serveMetrics(addr string, cm *connmgr.BasicConnMgr) (*http.Server, error) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "auc_libp2p_connections",
+		Help: "Libp2p connections tracked by the connection manager",
+	}, func() float64 {
+		return float64(cm.GetInfo().ConnCount)
+	})
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("serving metrics: %s", err)
+		}
+	}()
+
+	return srv, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/event"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+)
+
+const (
+	reachabilityAuto    = "auto"
+	reachabilityPublic  = "public"
+	reachabilityPrivate = "private"
+)
+
+// natOptions returns the libp2p options for AutoNAT and hole punching configured in the daemon flags.
+func natOptions() ([]libp2p.Option, error) {
+	var opts []libp2p.Option
+	switch reachability := v.GetString("reachability"); reachability {
+	case reachabilityAuto:
+		log.Infof("Reachability is detected with AutoNAT")
+	case reachabilityPublic:
+		opts = append(opts, libp2p.ForceReachabilityPublic())
+		log.Infof("Reachability is forced to public")
+	case reachabilityPrivate:
+		opts = append(opts, libp2p.ForceReachabilityPrivate())
+		log.Infof("Reachability is forced to private")
+	default:
+		return nil, fmt.Errorf("unknown reachability %q", reachability)
+	}
+	if v.GetBool("autonat-service") {
+		opts = append(opts, libp2p.EnableNATService())
+		log.Infof("AutoNAT service enabled")
+	}
+	if v.GetBool("hole-punching") {
+		opts = append(opts, libp2p.EnableHolePunching(holepunch.WithTracer(holePunchTracer{})))
+		log.Infof("Hole punching enabled")
+	} else {
+		log.Warnf("hole punching is disabled, so requests to NATed hosts go through relays")
+	}
+	return opts, nil
+}
+
+// logReachability logs the changes in the reachability of the host detected by AutoNAT,
+// until the returned function is called.
+func logReachability(h host.Host) (func() error, error) {
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged))
+	if err != nil {
+		return nil, fmt.Errorf("subscribing to reachability changes: %s", err)
+	}
+	go func() {
+		for e := range sub.Out() {
+			log.Infof("Reachability changed to %s", e.(event.EvtLocalReachabilityChanged).Reachability)
+		}
+	}()
+	return sub.Close, nil
+}
+
+// holePunchTracer logs the outcome of hole punching attempts with remote peers.
+type holePunchTracer struct{}
+
+func (holePunchTracer) Trace(e *holepunch.Event) {
+	switch evt := e.Evt.(type) {
+	case *holepunch.EndHolePunchEvt:
+		if evt.Success {
+			log.Infof("hole punched with %s in %s", e.Remote, evt.EllapsedTime)
+			return
+		}
+		log.Warnf("hole punching with %s failed after %s: %s", e.Remote, evt.EllapsedTime, evt.Error)
+	case *holepunch.DirectDialEvt:
+		if evt.Success {
+			log.Infof("direct connection with %s established in %s", e.Remote, evt.EllapsedTime)
+			return
+		}
+		log.Debugf("direct dial with %s failed, hole punching: %s", e.Remote, evt.Error)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/approval"
+)
+
+const (
+	adminSocketFilename = "admin.sock"
+)
+
+var walletApprovalsCmd = &cobra.Command{
+	Use:   "approvals",
+	Short: "Manage deal proposals waiting for manual approval in a running daemon",
+	Long:  "Manage deal proposals waiting for manual approval in a running daemon",
+	Args:  cobra.ExactArgs(0),
+}
+
+var walletApprovalsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List deal proposals waiting for approval",
+	Long:  "List deal proposals waiting for approval",
+	Args:  cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		reqs, err := newApprovalsClient().List(c.Context())
+		cli.CheckErrf("listing pending approvals: %s", err)
+		if len(reqs) == 0 {
+			fmt.Println("No deal proposals waiting for approval.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tRECEIVED\tADDRESS\tPROVIDER\tPIECE SIZE\tDURATION\tCOST (attoFIL)")
+		for _, r := range reqs {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n",
+				r.ID, r.ReceivedAt.Format(time.RFC3339), r.WalletAddress, r.Provider, r.PieceSize, r.Duration, r.Cost)
+		}
+		err = w.Flush()
+		cli.CheckErrf("printing pending approvals: %s", err)
+	},
+}
+
+var walletApprovalsApproveCmd = &cobra.Command{
+	Use:   "approve <id>",
+	Short: "Approve a deal proposal to be signed",
+	Long:  "Approve a deal proposal to be signed",
+	Args:  cobra.ExactArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		err := newApprovalsClient().Approve(c.Context(), args[0])
+		cli.CheckErrf("approving deal proposal: %s", err)
+		fmt.Printf("Deal proposal %s approved.\n", args[0])
+	},
+}
+
+var walletApprovalsRejectCmd = &cobra.Command{
+	Use:   "reject <id>",
+	Short: "Reject a deal proposal, so it isn't signed",
+	Long:  "Reject a deal proposal, so it isn't signed",
+	Args:  cobra.ExactArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		err := newApprovalsClient().Reject(c.Context(), args[0])
+		cli.CheckErrf("rejecting deal proposal: %s", err)
+		fmt.Printf("Deal proposal %s rejected.\n", args[0])
+	},
+}
+
+func newApprovalsClient() *approval.Client {
+	return approval.NewClient(filepath.Join(configPath, adminSocketFilename))
+}
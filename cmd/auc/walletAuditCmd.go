@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/audit"
+)
+
+const (
+	auditLogFilename = "audit.log"
+)
+
+var walletAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log of signing requests",
+	Long:  "Inspect the audit log of signing requests",
+	Args:  cobra.ExactArgs(0),
+}
+
+var walletAuditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that the audit log hasn't been tampered",
+	Long:  "Verify that the audit log hasn't been tampered",
+	Args:  cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		count, head, err := audit.Verify(filepath.Join(configPath, auditLogFilename))
+		cli.CheckErrf("audit log verification failed: %s", err)
+		fmt.Printf("Audit log is valid (%d entries).\n", count)
+		fmt.Printf("Head hash: %q\n", head)
+	},
+}
+
+var walletAuditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recorded signing requests",
+	Long:  "List the recorded signing requests, optionally filtered by wallet address, storage-provider or date",
+	Args:  cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		var f audit.Filter
+		var err error
+		f.Address, err = c.Flags().GetString("address")
+		cli.CheckErrf("reading address flag: %s", err)
+		f.Provider, err = c.Flags().GetString("provider")
+		cli.CheckErrf("reading provider flag: %s", err)
+		f.Since, err = parseDateFlag(c, "since")
+		cli.CheckErrf("parsing since flag: %s", err)
+		f.Until, err = parseDateFlag(c, "until")
+		cli.CheckErrf("parsing until flag: %s", err)
+
+		entries, err := audit.List(filepath.Join(configPath, auditLogFilename), f)
+		cli.CheckErrf("listing audit log: %s", err)
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			err := enc.Encode(e)
+			cli.CheckErrf("printing entry: %s", err)
+		}
+	},
+}
+
+func parseDateFlag(c *cobra.Command, name string) (time.Time, error) {
+	val, err := c.Flags().GetString(name)
+	if err != nil || val == "" {
+		return time.Time{}, err
+	}
+	if t, err := time.Parse(time.RFC3339, val); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", val)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/extwallet"
+	"github.com/textileio/go-auctions-client/localwallet"
+	"github.com/textileio/go-auctions-client/lotuswallet"
+	"github.com/textileio/go-auctions-client/propsigner"
+)
+
+const (
+	walletBackendLocal    = "local"
+	walletBackendExternal = "external"
+	walletBackendLotus    = "lotus"
+
+	lotusAPITimeout = 30 * time.Second
+)
+
+// newWallet returns the wallet of the configured backend, and a function to close it.
+func newWallet() (propsigner.Wallet, func() error, error) {
+	switch backend := v.GetString("wallet-backend"); backend {
+	case walletBackendLocal:
+		w, err := newLocalWallet()
+		if err != nil {
+			return nil, nil, err
+		}
+		return w, func() error { return nil }, nil
+	case walletBackendExternal:
+		args := cli.ParseStringSlice(v, "external-wallet-args")
+		w, err := extwallet.New(v.GetString("external-wallet-cmd"), args, v.GetDuration("external-wallet-timeout"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating external wallet: %s", err)
+		}
+		log.Infof("Using external wallet: %s", v.GetString("external-wallet-cmd"))
+		return w, w.Close, nil
+	case walletBackendLotus:
+		w, err := lotuswallet.New(v.GetString("lotus-api"), v.GetString("lotus-token"), lotusAPITimeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating lotus wallet: %s", err)
+		}
+		log.Infof("Using lotus wallet: %s", v.GetString("lotus-api"))
+		return w, func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown wallet backend %q", backend)
+	}
+}
+
+func newLocalWallet() (*localwallet.Wallet, error) {
+	walletKeys := v.GetStringSlice("wallet-keys")
+	if _, err := os.Stat(keystorePath()); err == nil {
+		passphrase, err := readPassphrase(v.GetInt("passphrase-fd"), false)
+		if err != nil {
+			return nil, fmt.Errorf("reading keystore passphrase: %s", err)
+		}
+		keystoreKeys, err := localwallet.ReadKeystore(keystorePath(), passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("opening keystore: %s", err)
+		}
+		walletKeys = append(walletKeys, keystoreKeys...)
+		log.Infof("Loaded %d keys from keystore %s", len(keystoreKeys), keystorePath())
+	} else if len(walletKeys) > 0 {
+		log.Warnf("wallet keys are configured in cleartext; consider running `auc wallet keystore create`")
+	}
+	wallet, err := localwallet.New(walletKeys)
+	if err != nil {
+		return nil, fmt.Errorf("creating local wallet: %s", err)
+	}
+	for _, addr := range wallet.GetAddresses() {
+		log.Infof("Loaded wallet: %s", addr)
+	}
+	return wallet, nil
+}
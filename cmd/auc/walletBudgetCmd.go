@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/budget"
+)
+
+var walletBudgetCmd = &cobra.Command{
+	Use:   "budget",
+	Short: "Show the current spending versus the configured budget of wallet addresses",
+	Long:  "Show the current spending versus the configured budget of wallet addresses",
+	Args:  cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		budgets, err := loadBudgets()
+		cli.CheckErrf("reading budgets config: %s", err)
+		tracker, err := budget.New(filepath.Join(configPath, budgetLedgerFilename), budgets)
+		cli.CheckErrf("opening budget ledger: %s", err)
+		defer func() {
+			if err := tracker.Close(); err != nil {
+				log.Errorf("closing budget tracker: %s", err)
+			}
+		}()
+
+		statuses := tracker.Status()
+		if len(statuses) == 0 {
+			fmt.Println("No budgets configured.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ADDRESS\tSPENT (attoFIL)\tBUDGET (attoFIL)\tWINDOW")
+		for _, s := range statuses {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Address, s.Spent, s.Budget, s.Window)
+		}
+		err = w.Flush()
+		cli.CheckErrf("printing budgets: %s", err)
+	},
+}
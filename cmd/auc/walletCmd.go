@@ -1,20 +1,37 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/libp2p/go-libp2p"
 	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/multiformats/go-multibase"
 	"github.com/spf13/cobra"
 	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/approval"
+	"github.com/textileio/go-auctions-client/audit"
+	"github.com/textileio/go-auctions-client/auth"
+	"github.com/textileio/go-auctions-client/budget"
 	"github.com/textileio/go-auctions-client/buildinfo"
-	"github.com/textileio/go-auctions-client/localwallet"
+	"github.com/textileio/go-auctions-client/policy"
 	"github.com/textileio/go-auctions-client/propsigner"
 	"github.com/textileio/go-auctions-client/relaymgr"
+	"github.com/textileio/go-auctions-client/replay"
+)
+
+const (
+	noncesFilename       = "nonces"
+	budgetLedgerFilename = "budget.ledger"
+	defaultAuthTokenName = "default"
 )
 
 var walletCmd = &cobra.Command{
@@ -37,18 +54,30 @@ var walletDaemonCmd = &cobra.Command{
 	Run: func(c *cobra.Command, args []string) {
 		log.Infof("auc %s", buildinfo.Summary())
 
-		settings, err := cli.MarshalConfig(v, !v.GetBool("log-json"), "wallet-keys", "auth-token", "private-key")
+		settings, err := cli.MarshalConfig(
+			v,
+			!v.GetBool("log-json"),
+			"wallet-keys",
+			"auth-token",
+			"auth-tokens",
+			"lotus-token",
+			"private-key")
 		cli.CheckErrf("marshaling config: %v", err)
 		log.Infof("loaded config from %s: %s", v.ConfigFileUsed(), string(settings))
 
-		authToken := v.GetString("auth-token")
-		walletKeys := v.GetStringSlice("wallet-keys")
-		wallet, err := localwallet.New(walletKeys)
-		cli.CheckErrf("creating local wallet: %s", err)
-		addrs := wallet.GetAddresses()
-		for _, addr := range addrs {
-			log.Infof("Loaded wallet: %s", addr)
+		authTokens, err := loadAuthTokens()
+		cli.CheckErrf("reading auth tokens config: %s", err)
+		if len(authTokens) == 0 {
+			log.Fatalf("at least one auth token must be configured")
 		}
+		tokens, err := auth.New(authTokens)
+		cli.CheckErrf("creating auth tokens: %s", err)
+		for name := range authTokens {
+			log.Infof("Loaded auth token: %s", name)
+		}
+
+		wallet, closeWallet, err := newWallet()
+		cli.CheckErrf("creating wallet: %s", err)
 
 		_, key, err := multibase.Decode(v.GetString("private-key"))
 		cli.CheckErrf("decoding private key: %v", err)
@@ -66,37 +95,217 @@ var walletDaemonCmd = &cobra.Command{
 			opts = append(opts, libp2p.ListenAddrs(listenMaddr))
 		}
 
+		natOpts, err := natOptions()
+		cli.CheckErrf("configuring nat traversal: %s", err)
+		opts = append(opts, natOpts...)
+
 		h, err := libp2p.New(opts...)
 		cli.CheckErrf("creating libp2p host: %s", err)
 		printHostInfo(h)
+		stopReachabilityLog, err := logReachability(h)
+		cli.CheckErrf("logging reachability: %s", err)
+
+		var metricsServer *http.Server
+		if metricsAddr := v.GetString("metrics-addr"); metricsAddr != "" {
+			metricsServer, err = serveMetrics(metricsAddr, conmgr)
+			cli.CheckErrf("serving metrics: %s", err)
+			log.Infof("Serving metrics in http://%s/metrics", metricsAddr)
+		}
 
 		var rlymgr *relaymgr.RelayManager
-		if v.GetString("relay-maddr") != "" {
-			rlymgr, err = relaymgr.New(c.Context(), h, v.GetString("relay-maddr"))
-			cli.CheckErrf("connecting with relay: %s", err)
+		if relayMaddrs := cli.ParseStringSlice(v, "relay-maddr"); len(relayMaddrs) > 0 {
+			rlymgr, err = relaymgr.New(
+				c.Context(),
+				h,
+				relayMaddrs,
+				relaymgr.WithMaxReservations(v.GetInt("relay-reservations")),
+				relaymgr.WithReconnectBackoff(relaymgr.Backoff{
+					MinDelay: v.GetDuration("relay-reconnect-min-delay"),
+					MaxDelay: v.GetDuration("relay-reconnect-max-delay"),
+					Jitter:   0.2,
+				}),
+				relaymgr.WithMaxReconnectAttempts(v.GetInt("relay-reconnect-alert-attempts")))
+			cli.CheckErrf("connecting with relays: %s", err)
 
-			maddrcircuit := v.GetString("relay-maddr") + "/p2p-circuit/" + h.ID().String()
-			log.Infof("Relayed multiaddr: %s", maddrcircuit)
+			for _, maddrcircuit := range rlymgr.RelayedAddrs() {
+				log.Infof("Relayed multiaddr: %s", maddrcircuit)
+			}
 		} else {
 			log.Warnf("libp2p relaying is disabled")
 		}
 
-		err = propsigner.NewDealSignerService(h, authToken, wallet)
+		policies, err := loadPolicies()
+		cli.CheckErrf("reading policies config: %s", err)
+		policyEngine, err := policy.New(policies)
+		cli.CheckErrf("creating policy engine: %s", err)
+		for addr := range policies {
+			log.Infof("Loaded signing policy for wallet: %s", addr)
+		}
+
+		budgets, err := loadBudgets()
+		cli.CheckErrf("reading budgets config: %s", err)
+		budgetTracker, err := budget.New(filepath.Join(configPath, budgetLedgerFilename), budgets)
+		cli.CheckErrf("creating budget tracker: %s", err)
+		for addr, b := range budgets {
+			log.Infof("Loaded spending budget for wallet %s: %s attoFIL every %s", addr, b.Amount, b.Window)
+		}
+
+		approvals, err := loadApprovals()
+		cli.CheckErrf("reading approvals config: %s", err)
+		approvalQueue, err := approval.New(approvals)
+		cli.CheckErrf("creating approval queue: %s", err)
+		for addr, a := range approvals {
+			log.Infof("Proposals for wallet %s costing more than %s attoFIL require approval", addr, a.Threshold)
+		}
+		adminServer, err := approval.NewAdminServer(filepath.Join(configPath, adminSocketFilename), approvalQueue)
+		cli.CheckErrf("creating admin socket: %s", err)
+
+		auditLog, err := audit.Open(filepath.Join(configPath, auditLogFilename))
+		cli.CheckErrf("opening audit log: %s", err)
+
+		v.OnConfigChange(func(e fsnotify.Event) {
+			log.Infof("reloading config from %s", e.Name)
+			authTokens, err := loadAuthTokens()
+			if err != nil {
+				log.Errorf("reading reloaded auth tokens config: %s", err)
+			} else if err := tokens.Update(authTokens); err != nil {
+				log.Errorf("updating auth tokens, keeping previous ones: %s", err)
+			}
+			policies, err := loadPolicies()
+			if err != nil {
+				log.Errorf("reading reloaded policies config: %s", err)
+			} else if err := policyEngine.Update(policies); err != nil {
+				log.Errorf("updating policies, keeping previous ones: %s", err)
+			}
+			budgets, err := loadBudgets()
+			if err != nil {
+				log.Errorf("reading reloaded budgets config: %s", err)
+			} else if err := budgetTracker.Update(budgets); err != nil {
+				log.Errorf("updating budgets, keeping previous ones: %s", err)
+			}
+			approvals, err := loadApprovals()
+			if err != nil {
+				log.Errorf("reading reloaded approvals config: %s", err)
+			} else if err := approvalQueue.Update(approvals); err != nil {
+				log.Errorf("updating approvals, keeping previous ones: %s", err)
+			}
+		})
+		v.WatchConfig()
+
+		// Cancelled on shutdown, so requests waiting for approval or the wallet are aborted.
+		signerCtx, cancelSigner := context.WithCancel(context.Background())
+		signerOpts := []propsigner.Option{
+			propsigner.WithContext(signerCtx),
+			propsigner.WithAuthorizer(tokens),
+			propsigner.WithDealProposalPolicy(policyEngine),
+			propsigner.WithSpendingBudget(budgetTracker),
+			propsigner.WithApprovalQueue(approvalQueue),
+			propsigner.WithAuditLog(auditLog),
+		}
+		if allowedPeers := cli.ParseStringSlice(v, "allowed-peers"); len(allowedPeers) > 0 {
+			peers := make([]peer.ID, len(allowedPeers))
+			for i, p := range allowedPeers {
+				peers[i], err = peer.Decode(p)
+				cli.CheckErrf("parsing allowed peer-id: %s", err)
+				log.Infof("Allowed peer: %s", peers[i])
+			}
+			signerOpts = append(signerOpts, propsigner.WithAllowedPeers(peers...))
+		}
+		var nonceStore *replay.Store
+		if maxClockSkew := v.GetDuration("max-clock-skew"); maxClockSkew > 0 {
+			nonceStore, err = replay.Open(filepath.Join(configPath, noncesFilename))
+			cli.CheckErrf("opening nonce store: %s", err)
+			signerOpts = append(signerOpts, propsigner.WithReplayProtection(nonceStore, maxClockSkew))
+			log.Infof("Replay protection enabled with max clock skew %s", maxClockSkew)
+		} else {
+			log.Warnf("replay protection is disabled")
+		}
+		if v.GetBool("disable-v1-protocol") {
+			signerOpts = append(signerOpts, propsigner.WithV1ProtocolDisabled())
+			log.Infof("Only challenge-response authenticated signing requests are accepted")
+		}
+		err = propsigner.NewDealSignerService(h, "", wallet, signerOpts...)
 		cli.CheckErrf("creating deal signer service: %s", err)
 
 		cli.HandleInterrupt(func() {
+			cancelSigner()
 			if rlymgr != nil {
 				if err := rlymgr.Close(); err != nil {
 					log.Errorf("closing relay manager: %s", err)
 				}
 			}
+			if err := stopReachabilityLog(); err != nil {
+				log.Errorf("closing reachability subscription: %s", err)
+			}
 			if err := h.Close(); err != nil {
 				log.Errorf("closing libp2p host: %s", err)
 			}
+			if err := closeWallet(); err != nil {
+				log.Errorf("closing wallet: %s", err)
+			}
+			if metricsServer != nil {
+				if err := metricsServer.Close(); err != nil {
+					log.Errorf("closing metrics server: %s", err)
+				}
+			}
+			if err := adminServer.Close(); err != nil {
+				log.Errorf("closing admin socket: %s", err)
+			}
+			if err := budgetTracker.Close(); err != nil {
+				log.Errorf("closing budget tracker: %s", err)
+			}
+			if err := auditLog.Close(); err != nil {
+				log.Errorf("closing audit log: %s", err)
+			}
+			if nonceStore != nil {
+				if err := nonceStore.Close(); err != nil {
+					log.Errorf("closing nonce store: %s", err)
+				}
+			}
 		})
 	},
 }
 
+// loadAuthTokens returns the named auth tokens from the config, including
+// the single auth-token flag as the "default" token if provided.
+func loadAuthTokens() (map[string]auth.Config, error) {
+	tokens := map[string]auth.Config{}
+	if err := v.UnmarshalKey("auth-tokens", &tokens); err != nil {
+		return nil, err
+	}
+	if authToken := v.GetString("auth-token"); authToken != "" {
+		if _, ok := tokens[defaultAuthTokenName]; ok {
+			return nil, fmt.Errorf("auth token %s is configured twice", defaultAuthTokenName)
+		}
+		tokens[defaultAuthTokenName] = auth.Config{Token: authToken}
+	}
+	return tokens, nil
+}
+
+func loadPolicies() (map[string]policy.Config, error) {
+	policies := map[string]policy.Config{}
+	if err := v.UnmarshalKey("policies", &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func loadBudgets() (map[string]budget.Config, error) {
+	budgets := map[string]budget.Config{}
+	if err := v.UnmarshalKey("budgets", &budgets); err != nil {
+		return nil, err
+	}
+	return budgets, nil
+}
+
+func loadApprovals() (map[string]approval.Config, error) {
+	approvals := map[string]approval.Config{}
+	if err := v.UnmarshalKey("approvals", &approvals); err != nil {
+		return nil, err
+	}
+	return approvals, nil
+}
+
 func printHostInfo(h host.Host) {
 	log.Infof("libp2p peer-id: %s", h.ID())
 	for _, maddr := range h.Addrs() {
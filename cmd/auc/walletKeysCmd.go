@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/spf13/cobra"
+	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/localwallet"
+)
+
+var walletKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the wallet keys of the encrypted keystore",
+	Long: `Manage the wallet keys of the encrypted keystore used by the daemon.
+The daemon must be restarted to use the changes.`,
+	Args: cobra.ExactArgs(0),
+}
+
+var walletKeysImportCmd = &cobra.Command{
+	Use:   "import [hex-key]",
+	Short: "Import a private key exported with lotus wallet export",
+	Long: `Import a private key exported with lotus wallet export.
+The key is read from the argument, the file provided in --file, or stdin.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		pk, err := readImportedKey(c, args)
+		cli.CheckErrf("reading private key: %s", err)
+		key, err := localwallet.DescribeKey(pk)
+		cli.CheckErrf("parsing private key: %s", err)
+
+		passphrase, keys, err := openKeystore(c, true)
+		cli.CheckErrf("opening keystore: %s", err)
+		if _, ok := findKey(keys, key.Address); ok {
+			cli.CheckErr(fmt.Errorf("key for %s is already in the keystore", key.Address))
+		}
+		err = localwallet.WriteKeystore(keystorePath(), passphrase, append(keys, pk))
+		cli.CheckErrf("writing keystore: %s", err)
+		fmt.Printf("Imported %s key for %s.\n", key.Type, key.Address)
+	},
+}
+
+var walletKeysNewCmd = &cobra.Command{
+	Use:   "new",
+	Short: "Generate a new private key in the keystore",
+	Long:  "Generate a new private key in the keystore",
+	Args:  cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		keyType, err := c.Flags().GetString("type")
+		cli.CheckErrf("reading type flag: %s", err)
+		pk, err := localwallet.GenerateKey(keyType)
+		cli.CheckErrf("generating key: %s", err)
+		key, err := localwallet.DescribeKey(pk)
+		cli.CheckErrf("parsing generated key: %s", err)
+
+		passphrase, keys, err := openKeystore(c, true)
+		cli.CheckErrf("opening keystore: %s", err)
+		err = localwallet.WriteKeystore(keystorePath(), passphrase, append(keys, pk))
+		cli.CheckErrf("writing keystore: %s", err)
+		fmt.Println(key.Address)
+	},
+}
+
+var walletKeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the addresses and key types in the keystore",
+	Long:  "List the addresses and key types in the keystore",
+	Args:  cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		_, keys, err := openKeystore(c, false)
+		cli.CheckErrf("opening keystore: %s", err)
+		if len(keys) == 0 {
+			fmt.Println("No keys in the keystore.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ADDRESS\tTYPE")
+		for _, pk := range keys {
+			key, err := localwallet.DescribeKey(pk)
+			cli.CheckErrf("parsing key: %s", err)
+			_, _ = fmt.Fprintf(w, "%s\t%s\n", key.Address, key.Type)
+		}
+		err = w.Flush()
+		cli.CheckErrf("printing keys: %s", err)
+	},
+}
+
+var walletKeysExportCmd = &cobra.Command{
+	Use:   "export <address>",
+	Short: "Export a private key in the lotus wallet export format",
+	Long:  "Export a private key in the lotus wallet export format",
+	Args:  cobra.ExactArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		_, keys, err := openKeystore(c, false)
+		cli.CheckErrf("opening keystore: %s", err)
+		i, ok := findKey(keys, args[0])
+		if !ok {
+			cli.CheckErr(fmt.Errorf("key for %s isn't in the keystore", args[0]))
+		}
+		fmt.Println(keys[i])
+	},
+}
+
+var walletKeysRemoveCmd = &cobra.Command{
+	Use:   "remove <address>",
+	Short: "Remove a private key from the keystore",
+	Long:  "Remove a private key from the keystore. Export it first if you might need it later.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(c *cobra.Command, args []string) {
+		passphrase, keys, err := openKeystore(c, false)
+		cli.CheckErrf("opening keystore: %s", err)
+		i, ok := findKey(keys, args[0])
+		if !ok {
+			cli.CheckErr(fmt.Errorf("key for %s isn't in the keystore", args[0]))
+		}
+		keys = append(keys[:i], keys[i+1:]...)
+		err = localwallet.WriteKeystore(keystorePath(), passphrase, keys)
+		cli.CheckErrf("writing keystore: %s", err)
+		fmt.Printf("Removed key for %s.\n", args[0])
+	},
+}
+
+// openKeystore returns the passphrase and keys of the keystore. If the keystore
+// doesn't exist and create is true, it returns a new passphrase and no keys.
+func openKeystore(c *cobra.Command, create bool) ([]byte, []string, error) {
+	fd, err := c.Flags().GetInt("passphrase-fd")
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading passphrase-fd flag: %s", err)
+	}
+	if _, err := os.Stat(keystorePath()); os.IsNotExist(err) {
+		if !create {
+			return nil, nil, fmt.Errorf("keystore %s doesn't exist", keystorePath())
+		}
+		fmt.Fprintf(os.Stderr, "Creating keystore %s.\n", keystorePath())
+		passphrase, err := readPassphrase(fd, true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading passphrase: %s", err)
+		}
+		return passphrase, nil, nil
+	}
+	passphrase, err := readPassphrase(fd, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading passphrase: %s", err)
+	}
+	keys, err := localwallet.ReadKeystore(keystorePath(), passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	return passphrase, keys, nil
+}
+
+// findKey returns the index of the key for addr, regardless of the address network prefix.
+func findKey(keys []string, addr string) (int, bool) {
+	target, err := address.NewFromString(addr)
+	if err != nil {
+		return 0, false
+	}
+	for i, pk := range keys {
+		key, err := localwallet.DescribeKey(pk)
+		if err != nil {
+			continue
+		}
+		if a, err := address.NewFromString(key.Address); err == nil && a == target {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func readImportedKey(c *cobra.Command, args []string) (string, error) {
+	path, err := c.Flags().GetString("file")
+	if err != nil {
+		return "", fmt.Errorf("reading file flag: %s", err)
+	}
+	switch {
+	case len(args) == 1 && path != "":
+		return "", fmt.Errorf("the key and --file can't be both provided")
+	case len(args) == 1:
+		return strings.TrimSpace(args[0]), nil
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading key file: %s", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	default:
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if line == "" && err != nil {
+			return "", fmt.Errorf("reading stdin: %s", err)
+		}
+		return strings.TrimSpace(line), nil
+	}
+}
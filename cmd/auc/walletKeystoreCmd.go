@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/textileio/cli"
+	"github.com/textileio/go-auctions-client/localwallet"
+	"golang.org/x/term"
+)
+
+const (
+	keystoreFilename = "keystore"
+	// passphraseEnvVar isn't a flag, so the passphrase can't end up in the config file.
+	passphraseEnvVar = "AUC_KEYSTORE_PASSPHRASE"
+)
+
+var walletKeystoreCmd = &cobra.Command{
+	Use:   "keystore",
+	Short: "Manage the encrypted keystore of wallet keys",
+	Long:  "Manage the encrypted keystore of wallet keys",
+	Args:  cobra.ExactArgs(0),
+}
+
+var walletKeystoreCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an encrypted keystore with the configured wallet keys",
+	Long: `Create an encrypted keystore with the wallet keys configured in the config file or flags.
+After creating it, remove the wallet-keys from the config file so they aren't stored in cleartext.`,
+	Args: cobra.ExactArgs(0),
+	Run: func(c *cobra.Command, args []string) {
+		walletKeys := v.GetStringSlice("wallet-keys")
+		if len(walletKeys) == 0 {
+			cli.CheckErr(fmt.Errorf("no wallet keys are configured"))
+		}
+		path := keystorePath()
+		if _, err := os.Stat(path); err == nil {
+			cli.CheckErr(fmt.Errorf("keystore %s already exists", path))
+		}
+
+		fd, err := c.Flags().GetInt("passphrase-fd")
+		cli.CheckErrf("reading passphrase-fd flag: %s", err)
+		passphrase, err := readPassphrase(fd, true)
+		cli.CheckErrf("reading passphrase: %s", err)
+		err = localwallet.WriteKeystore(path, passphrase, walletKeys)
+		cli.CheckErrf("writing keystore: %s", err)
+
+		fmt.Printf("Keystore with %d keys created in %s.\n", len(walletKeys), path)
+		fmt.Println("Remember to remove wallet-keys from your config file.")
+	},
+}
+
+func keystorePath() string {
+	return filepath.Join(configPath, keystoreFilename)
+}
+
+// readPassphrase reads the keystore passphrase from the fd file descriptor if it isn't
+// negative, the AUC_KEYSTORE_PASSPHRASE env var, or prompts for it in the terminal.
+func readPassphrase(fd int, confirm bool) ([]byte, error) {
+	if fd >= 0 {
+		f := os.NewFile(uintptr(fd), "passphrase-fd")
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor %d", fd)
+		}
+		defer func() { _ = f.Close() }()
+		line, err := bufio.NewReader(f).ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, fmt.Errorf("reading file descriptor %d: %s", fd, err)
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+	if passphrase := os.Getenv(passphraseEnvVar); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	stdin := int(os.Stdin.Fd())
+	if !term.IsTerminal(stdin) {
+		return nil, fmt.Errorf("no terminal to prompt for it; use --passphrase-fd or %s", passphraseEnvVar)
+	}
+	fmt.Fprint(os.Stderr, "Keystore passphrase: ")
+	passphrase, err := term.ReadPassword(stdin)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("prompting passphrase: %s", err)
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat passphrase: ")
+		repeated, err := term.ReadPassword(stdin)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("prompting passphrase: %s", err)
+		}
+		if !bytes.Equal(passphrase, repeated) {
+			return nil, fmt.Errorf("passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
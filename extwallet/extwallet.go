@@ -0,0 +1,239 @@
+package extwallet
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+	logger "github.com/textileio/go-log/v2"
+)
+
+const (
+	methodHas  = "has"
+	methodSign = "sign"
+
+	signatureTypeSecp256k1 = "secp256k1"
+	signatureTypeBLS       = "bls"
+)
+
+var (
+	log = logger.Logger("extwallet")
+
+	errTimeout = errors.New("external wallet didn't reply in time")
+)
+
+// Request is a line written to the stdin of the external process.
+type Request struct {
+	ID      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Address string `json:"address"`
+	// Payload is the data to be signed, only present in sign requests.
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// Response is a line read from the stdout of the external process.
+type Response struct {
+	ID    uint64 `json:"id"`
+	Error string `json:"error,omitempty"`
+	// Has is the reply of has requests.
+	Has bool `json:"has,omitempty"`
+	// SignatureType is "secp256k1" or "bls" in replies of sign requests.
+	SignatureType string `json:"signature_type,omitempty"`
+	// Signature is the signature data in replies of sign requests.
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// Wallet delegates signing to an external process. Requests and responses are
+// newline-delimited JSON written to the stdin and read from the stdout of the process.
+// Byte fields are base64 encoded. The stderr of the process is forwarded.
+type Wallet struct {
+	command string
+	args    []string
+	timeout time.Duration
+
+	lock   sync.Mutex
+	nextID uint64
+	proc   *process
+}
+
+type process struct {
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	responses chan Response
+}
+
+// New starts the external process command with args. Requests not replied
+// within timeout fail, and the process is restarted in the next request.
+func New(command string, args []string, timeout time.Duration) (*Wallet, error) {
+	if command == "" {
+		return nil, fmt.Errorf("external wallet command is empty")
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("timeout must be positive")
+	}
+	w := &Wallet{
+		command: command,
+		args:    args,
+		timeout: timeout,
+	}
+	proc, err := w.start()
+	if err != nil {
+		return nil, err
+	}
+	w.proc = proc
+
+	return w, nil
+}
+
+// Has returns true if the external wallet contains the private keys of addr.
+func (w *Wallet) Has(addr string) (bool, error) {
+	res, err := w.call(Request{Method: methodHas, Address: addr})
+	if err != nil {
+		return false, err
+	}
+	return res.Has, nil
+}
+
+// Sign returns the signature of payload for wallet address addr.
+func (w *Wallet) Sign(addr string, payload []byte) (*crypto.Signature, error) {
+	res, err := w.call(Request{Method: methodSign, Address: addr, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	sig := &crypto.Signature{Data: res.Signature}
+	switch res.SignatureType {
+	case signatureTypeSecp256k1:
+		sig.Type = crypto.SigTypeSecp256k1
+	case signatureTypeBLS:
+		sig.Type = crypto.SigTypeBLS
+	default:
+		return nil, fmt.Errorf("unknown signature type %q", res.SignatureType)
+	}
+	return sig, nil
+}
+
+// Close stops the external process.
+func (w *Wallet) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.proc == nil {
+		return nil
+	}
+	w.proc.stop()
+	w.proc = nil
+	return nil
+}
+
+func (w *Wallet) call(req Request) (Response, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.proc == nil {
+		log.Warnf("restarting external wallet process")
+		proc, err := w.start()
+		if err != nil {
+			return Response{}, err
+		}
+		w.proc = proc
+	}
+
+	w.nextID++
+	req.ID = w.nextID
+	line, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("marshaling request: %s", err)
+	}
+	if _, err := w.proc.stdin.Write(append(line, '\n')); err != nil {
+		w.proc.stop()
+		w.proc = nil
+		return Response{}, fmt.Errorf("writing request to external wallet: %s", err)
+	}
+
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case res, ok := <-w.proc.responses:
+			if !ok {
+				w.proc.stop()
+				w.proc = nil
+				return Response{}, fmt.Errorf("external wallet process exited")
+			}
+			if res.ID != req.ID {
+				// The process is restarted when a request times out, so late replies
+				// can't arrive. This is a misbehaving process.
+				log.Warnf("ignoring external wallet response with unexpected id %d", res.ID)
+				continue
+			}
+			if res.Error != "" {
+				return Response{}, fmt.Errorf("external wallet: %s", res.Error)
+			}
+			return res, nil
+		case <-timer.C:
+			w.proc.stop()
+			w.proc = nil
+			return Response{}, errTimeout
+		}
+	}
+}
+
+func (w *Wallet) start() (*process, error) {
+	cmd := exec.Command(w.command, w.args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating stdin pipe: %s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating stdout pipe: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting external wallet: %s", err)
+	}
+
+	p := &process{
+		cmd:       cmd,
+		stdin:     stdin,
+		responses: make(chan Response),
+	}
+	go func() {
+		defer close(p.responses)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var res Response
+			if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+				log.Errorf("unmarshaling external wallet response: %s", err)
+				continue
+			}
+			p.responses <- res
+		}
+		if err := scanner.Err(); err != nil {
+			log.Errorf("reading external wallet output: %s", err)
+		}
+	}()
+
+	return p, nil
+}
+
+// stop kills the process, which closes its stdout and stops the reading goroutine.
+func (p *process) stop() {
+	_ = p.stdin.Close()
+	if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		log.Errorf("killing external wallet process: %s", err)
+	}
+	go func() {
+		// Drain pending responses so the reading goroutine can exit.
+		for range p.responses {
+		}
+		_ = p.cmd.Wait()
+	}()
+}
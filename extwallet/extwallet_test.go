@@ -0,0 +1,119 @@
+package extwallet
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/jsign/go-filsigner/wallet"
+	"github.com/stretchr/testify/require"
+	"github.com/textileio/go-auctions-client/localwallet"
+)
+
+var (
+	walletKeys = []string{
+		// Secp256k1 exported private key in Lotus format.
+		"7b2254797065223a22736563703235366b31222c22507269766174654b6579223a226b35507976337148327349586343595a58594f5775453149326e32554539436861556b6c4e36695a5763453d227d", // nolint:lll
+		// BLS exported private key in Lotus format.
+		"7b2254797065223a22626c73222c22507269766174654b6579223a226862702f794666527439514c43716b6d566171415752436f50556777314b776971716e73684e49704e57513d227d", // nolint:lll
+	}
+)
+
+func TestHasAndSign(t *testing.T) {
+	t.Parallel()
+
+	w := newHelperWallet(t, "sign")
+	local, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	payload := []byte("payload")
+	for _, addr := range local.GetAddresses() {
+		ok, err := w.Has(addr)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		sig, err := w.Sign(addr, payload)
+		require.NoError(t, err)
+		sigBytes, err := sig.MarshalBinary()
+		require.NoError(t, err)
+		waddr, err := address.NewFromString(addr)
+		require.NoError(t, err)
+		ok, err = wallet.WalletVerify(waddr, payload, sigBytes)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	ok, err := w.Has("f01000")
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, err = w.Sign("f01000", payload)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "private key not found")
+}
+
+func TestRestart(t *testing.T) {
+	t.Parallel()
+
+	// The helper process hangs on sign requests, and exits on has requests.
+	w := newHelperWallet(t, "misbehave")
+	_, err := w.Sign("f01000", []byte("payload"))
+	require.ErrorIs(t, err, errTimeout)
+	_, err = w.Has("f01000")
+	require.Error(t, err)
+	_, err = w.Sign("f01000", []byte("payload"))
+	require.ErrorIs(t, err, errTimeout)
+}
+
+func newHelperWallet(t *testing.T, mode string) *Wallet {
+	w, err := New(os.Args[0], []string{"-test.run=TestHelperProcess", "--", mode}, time.Second)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, w.Close()) })
+	return w
+}
+
+// TestHelperProcess isn't a real test. It's used as the external wallet process.
+func TestHelperProcess(t *testing.T) {
+	if len(os.Args) < 2 || os.Args[len(os.Args)-2] != "--" {
+		return
+	}
+	mode := os.Args[len(os.Args)-1]
+	local, err := localwallet.New(walletKeys)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(1)
+		}
+		res := Response{ID: req.ID}
+		switch {
+		case mode == "misbehave" && req.Method == methodSign:
+			continue
+		case mode == "misbehave":
+			os.Exit(1)
+		case req.Method == methodHas:
+			res.Has, _ = local.Has(req.Address)
+		case req.Method == methodSign:
+			sig, err := local.Sign(req.Address, req.Payload)
+			if err != nil {
+				res.Error = err.Error()
+				break
+			}
+			res.Signature = sig.Data
+			res.SignatureType = signatureTypeBLS
+			if sig.Type == crypto.SigTypeSecp256k1 {
+				res.SignatureType = signatureTypeSecp256k1
+			}
+		}
+		_ = enc.Encode(res)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,37 @@
+// Package addrkey parses the Filecoin addresses that key configurations, such as
+// per wallet policies or allowed storage-providers. Configurations are keyed by
+// parsed address instead of its string, so they match regardless of the network
+// prefix of the configured and requested addresses.
+package addrkey
+
+import (
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+)
+
+// Parse parses a configured address.
+func Parse(a string) (address.Address, error) {
+	addr, err := address.NewFromString(a)
+	if err != nil {
+		return address.Undef, fmt.Errorf("parsing address %s: %s", a, err)
+	}
+	return addr, nil
+}
+
+// ParseSet parses the configured addresses as a set. It returns nil if there
+// are no addresses.
+func ParseSet(addrs []string) (map[address.Address]struct{}, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	res := make(map[address.Address]struct{}, len(addrs))
+	for _, a := range addrs {
+		addr, err := Parse(a)
+		if err != nil {
+			return nil, err
+		}
+		res[addr] = struct{}{}
+	}
+	return res, nil
+}
@@ -0,0 +1,39 @@
+package addrkey
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	mainnet, err := Parse("f01000")
+	require.NoError(t, err)
+	testnet, err := Parse("t01000")
+	require.NoError(t, err)
+	require.Equal(t, mainnet, testnet)
+
+	_, err = Parse("notanaddress")
+	require.Error(t, err)
+}
+
+func TestParseSet(t *testing.T) {
+	t.Parallel()
+
+	set, err := ParseSet(nil)
+	require.NoError(t, err)
+	require.Nil(t, set)
+
+	set, err = ParseSet([]string{"f01000", "t01000", "f01001"})
+	require.NoError(t, err)
+	require.Len(t, set, 2)
+	addr, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	require.Contains(t, set, addr)
+
+	_, err = ParseSet([]string{"f01000", "notanaddress"})
+	require.Error(t, err)
+}
@@ -0,0 +1,22 @@
+// Package backoff computes exponential backoffs with jitter, shared by the retries
+// of signing requests and the reconnections with relays.
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Exponential returns the wait after the failed attempt, starting at min for the first
+// one and doubling with each attempt up to max. A fraction jitter, between 0 and 1, of
+// the wait is randomized.
+func Exponential(min, max time.Duration, jitter float64, attempt int) time.Duration {
+	wait := min
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait - time.Duration(jitter*rand.Float64()*float64(wait))
+}
@@ -0,0 +1,28 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExponential(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, time.Second, Exponential(time.Second, 5*time.Second, 0, 1))
+	require.Equal(t, 2*time.Second, Exponential(time.Second, 5*time.Second, 0, 2))
+	require.Equal(t, 4*time.Second, Exponential(time.Second, 5*time.Second, 0, 3))
+	require.Equal(t, 5*time.Second, Exponential(time.Second, 5*time.Second, 0, 4))
+	require.Equal(t, 5*time.Second, Exponential(time.Second, 5*time.Second, 0, 100))
+
+	// Jittered waits are spread, and never exceed the unjittered one.
+	waits := map[time.Duration]struct{}{}
+	for i := 0; i < 100; i++ {
+		wait := Exponential(time.Second, 5*time.Second, 0.5, 2)
+		require.GreaterOrEqual(t, wait, time.Second)
+		require.LessOrEqual(t, wait, 2*time.Second)
+		waits[wait] = struct{}{}
+	}
+	require.Greater(t, len(waits), 1)
+}
@@ -0,0 +1,85 @@
+package localwallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	curve12381 "github.com/drand/kyber-bls12381"
+	"github.com/drand/kyber/util/random"
+	"github.com/jsign/go-filsigner/wallet"
+)
+
+const (
+	// KeyTypeBLS is the Lotus key type of BLS private keys.
+	KeyTypeBLS = "bls"
+	// KeyTypeSecp256k1 is the Lotus key type of secp256k1 private keys.
+	KeyTypeSecp256k1 = "secp256k1"
+)
+
+// keyInfo is the Lotus representation of a private key, which is hex-encoded
+// as JSON in the output of `lotus wallet export`.
+type keyInfo struct {
+	Type       string
+	PrivateKey []byte
+}
+
+// Key describes a private key.
+type Key struct {
+	Address string
+	Type    string
+}
+
+// GenerateKey returns a new private key of keyType in the hex-encoded Lotus format.
+func GenerateKey(keyType string) (string, error) {
+	var pk []byte
+	switch keyType {
+	case KeyTypeSecp256k1:
+		priv, err := secp256k1.GeneratePrivateKey()
+		if err != nil {
+			return "", fmt.Errorf("generating secp256k1 key: %s", err)
+		}
+		pk = priv.Serialize()
+	case KeyTypeBLS:
+		scalar := curve12381.NewKyberScalar().Pick(random.New(rand.Reader))
+		be, err := scalar.MarshalBinary()
+		if err != nil {
+			return "", fmt.Errorf("marshaling bls key: %s", err)
+		}
+		// Filecoin BLS private keys are little-endian.
+		pk = make([]byte, len(be))
+		for i := range be {
+			pk[i] = be[len(be)-1-i]
+		}
+	default:
+		return "", fmt.Errorf("unknown key type %q", keyType)
+	}
+
+	ki, err := json.Marshal(keyInfo{Type: keyType, PrivateKey: pk})
+	if err != nil {
+		return "", fmt.Errorf("marshaling key info: %s", err)
+	}
+	return hex.EncodeToString(ki), nil
+}
+
+// DescribeKey returns the address and type of a private key in the hex-encoded Lotus format.
+func DescribeKey(pk string) (Key, error) {
+	kiBytes, err := hex.DecodeString(pk)
+	if err != nil {
+		return Key{}, fmt.Errorf("decoding hex: %s", err)
+	}
+	var ki keyInfo
+	if err := json.Unmarshal(kiBytes, &ki); err != nil {
+		return Key{}, fmt.Errorf("unmarshaling key info: %s", err)
+	}
+	if ki.Type != KeyTypeBLS && ki.Type != KeyTypeSecp256k1 {
+		return Key{}, fmt.Errorf("unknown key type %q", ki.Type)
+	}
+	addr, err := wallet.PublicKey(pk)
+	if err != nil {
+		return Key{}, fmt.Errorf("get public key from private key: %s", err)
+	}
+	return Key{Address: addr.String(), Type: ki.Type}, nil
+}
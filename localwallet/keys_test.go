@@ -0,0 +1,50 @@
+package localwallet
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/jsign/go-filsigner/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	t.Parallel()
+
+	for _, keyType := range []string{KeyTypeBLS, KeyTypeSecp256k1} {
+		pk, err := GenerateKey(keyType)
+		require.NoError(t, err)
+		key, err := DescribeKey(pk)
+		require.NoError(t, err)
+		require.Equal(t, keyType, key.Type)
+
+		w, err := New([]string{pk})
+		require.NoError(t, err)
+		require.Equal(t, []string{key.Address}, w.GetAddresses())
+
+		payload := []byte("payload")
+		sig, err := w.Sign(key.Address, payload)
+		require.NoError(t, err)
+		sigBytes, err := sig.MarshalBinary()
+		require.NoError(t, err)
+		addr, err := address.NewFromString(key.Address)
+		require.NoError(t, err)
+		ok, err := wallet.WalletVerify(addr, payload, sigBytes)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	_, err := GenerateKey("rsa")
+	require.Error(t, err)
+}
+
+func TestDescribeKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := DescribeKey(walletKeys[1])
+	require.NoError(t, err)
+	require.Equal(t, KeyTypeBLS, key.Type)
+
+	_, err = DescribeKey("notahexkey")
+	require.Error(t, err)
+}
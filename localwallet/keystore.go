@@ -0,0 +1,195 @@
+package localwallet
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	kdfScrypt       = "scrypt"
+	cipherXChaCha   = "xchacha20-poly1305"
+
+	saltSize = 32
+	keySize  = chacha20poly1305.KeySize
+
+	// maxScryptN, maxScryptR and maxScryptP bound the scrypt parameters read from keystores,
+	// so a tampered file can't make the daemon allocate unbounded memory or spin forever.
+	// scrypt allocates 128*N*r bytes, so keys are derived with at most 4GiB.
+	maxScryptN = 1 << 20
+	maxScryptR = 32
+	maxScryptP = 16
+)
+
+var (
+	errWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+
+	// scryptN is the scrypt cost parameter used when writing keystores. Existing
+	// keystores are read with the parameters stored in the file.
+	scryptN = 1 << 15
+)
+
+// keystoreFile is the on-disk format of an encrypted keystore.
+type keystoreFile struct {
+	Version    int          `json:"version"`
+	KDF        string       `json:"kdf"`
+	KDFParams  scryptParams `json:"kdf_params"`
+	Cipher     string       `json:"cipher"`
+	Nonce      []byte       `json:"nonce"`
+	Ciphertext []byte       `json:"ciphertext"`
+}
+
+type scryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// validate checks that the parameters are accepted by scrypt and within the bounds
+// used for keystores.
+func (p scryptParams) validate() error {
+	if p.N <= 1 || p.N&(p.N-1) != 0 || p.N > maxScryptN {
+		return fmt.Errorf("n must be a power of two between 2 and %d, got %d", maxScryptN, p.N)
+	}
+	if p.R < 1 || p.R > maxScryptR {
+		return fmt.Errorf("r must be between 1 and %d, got %d", maxScryptR, p.R)
+	}
+	if p.P < 1 || p.P > maxScryptP {
+		return fmt.Errorf("p must be between 1 and %d, got %d", maxScryptP, p.P)
+	}
+	return nil
+}
+
+// keystoreContent is the plaintext of an encrypted keystore.
+type keystoreContent struct {
+	Keys []string `json:"keys"`
+}
+
+// Open returns a wallet with the private keys of the keystore in path, decrypted with passphrase.
+func Open(path string, passphrase []byte) (*Wallet, error) {
+	pks, err := ReadKeystore(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return New(pks)
+}
+
+// ReadKeystore returns the private keys of the keystore in path, in the same hex-encoded
+// Lotus format accepted by New.
+func ReadKeystore(path string, passphrase []byte) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading keystore: %s", err)
+	}
+	var ks keystoreFile
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("unmarshaling keystore: %s", err)
+	}
+	if ks.Version != keystoreVersion || ks.KDF != kdfScrypt || ks.Cipher != cipherXChaCha {
+		return nil, fmt.Errorf("unsupported keystore version %d (kdf %s, cipher %s)", ks.Version, ks.KDF, ks.Cipher)
+	}
+
+	if err := ks.KDFParams.validate(); err != nil {
+		return nil, fmt.Errorf("invalid keystore kdf params: %s", err)
+	}
+	aead, err := newAEAD(passphrase, ks.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(ks.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("keystore nonce has wrong size")
+	}
+	plaintext, err := aead.Open(nil, ks.Nonce, ks.Ciphertext, nil)
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+	var content keystoreContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return nil, fmt.Errorf("unmarshaling keystore content: %s", err)
+	}
+	return content.Keys, nil
+}
+
+// WriteKeystore encrypts the private keys with passphrase and writes them to path,
+// replacing any existing keystore. The file is only readable by the current user.
+func WriteKeystore(path string, passphrase []byte, pks []string) error {
+	if len(passphrase) == 0 {
+		return fmt.Errorf("passphrase is empty")
+	}
+	for _, pk := range pks {
+		if _, err := New([]string{pk}); err != nil {
+			return fmt.Errorf("validating private key: %s", err)
+		}
+	}
+
+	params := scryptParams{N: scryptN, R: 8, P: 1, Salt: make([]byte, saltSize)}
+	if _, err := rand.Read(params.Salt); err != nil {
+		return fmt.Errorf("generating salt: %s", err)
+	}
+	aead, err := newAEAD(passphrase, params)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generating nonce: %s", err)
+	}
+	plaintext, err := json.Marshal(keystoreContent{Keys: pks})
+	if err != nil {
+		return fmt.Errorf("marshaling keystore content: %s", err)
+	}
+	data, err := json.MarshalIndent(keystoreFile{
+		Version:    keystoreVersion,
+		KDF:        kdfScrypt,
+		KDFParams:  params,
+		Cipher:     cipherXChaCha,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling keystore: %s", err)
+	}
+
+	// Write to a temporary file first, so a failure doesn't leave a truncated keystore.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("creating temporary keystore: %s", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing temporary keystore: %s", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("syncing temporary keystore: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary keystore: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing keystore: %s", err)
+	}
+	return nil
+}
+
+func newAEAD(passphrase []byte, params scryptParams) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key from passphrase: %s", err)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %s", err)
+	}
+	return aead, nil
+}
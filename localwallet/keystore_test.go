@@ -0,0 +1,99 @@
+package localwallet
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	walletKeys = []string{
+		// Secp256k1 exported private key in Lotus format.
+		"7b2254797065223a22736563703235366b31222c22507269766174654b6579223a226b35507976337148327349586343595a58594f5775453149326e32554539436861556b6c4e36695a5763453d227d", // nolint:lll
+		// BLS exported private key in Lotus format.
+		"7b2254797065223a22626c73222c22507269766174654b6579223a226862702f794666527439514c43716b6d566171415752436f50556777314b776971716e73684e49704e57513d227d", // nolint:lll
+	}
+)
+
+func TestKeystore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keystore")
+	passphrase := []byte("correct horse battery staple")
+	require.NoError(t, WriteKeystore(path, passphrase, walletKeys))
+
+	// Private keys aren't stored in cleartext.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	for _, pk := range walletKeys {
+		require.False(t, strings.Contains(string(data), pk))
+	}
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	keys, err := ReadKeystore(path, passphrase)
+	require.NoError(t, err)
+	require.Equal(t, walletKeys, keys)
+
+	w, err := Open(path, passphrase)
+	require.NoError(t, err)
+	require.Len(t, w.GetAddresses(), 2)
+
+	_, err = Open(path, []byte("wrong passphrase"))
+	require.ErrorIs(t, err, errWrongPassphrase)
+}
+
+func TestWriteKeystoreInvalid(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keystore")
+	require.Error(t, WriteKeystore(path, nil, walletKeys))
+	require.Error(t, WriteKeystore(path, []byte("passphrase"), []string{"notakey"}))
+	_, err := os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestReadKeystoreInvalidParams(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "keystore")
+	passphrase := []byte("correct horse battery staple")
+	require.NoError(t, WriteKeystore(path, passphrase, walletKeys))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var ks keystoreFile
+	require.NoError(t, json.Unmarshal(data, &ks))
+
+	testCases := []struct {
+		name   string
+		params func(p *scryptParams)
+	}{
+		{name: "huge n", params: func(p *scryptParams) { p.N = 1 << 30 }},
+		{name: "n not power of two", params: func(p *scryptParams) { p.N = 1<<15 + 1 }},
+		{name: "n too small", params: func(p *scryptParams) { p.N = 1 }},
+		{name: "zero r", params: func(p *scryptParams) { p.R = 0 }},
+		{name: "huge r", params: func(p *scryptParams) { p.N, p.R, p.P = 1<<20, 1<<29, 1 }},
+		{name: "huge p", params: func(p *scryptParams) { p.P = 1 << 10 }},
+	}
+	for _, test := range testCases {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			tampered := ks
+			test.params(&tampered.KDFParams)
+			data, err := json.Marshal(tampered)
+			require.NoError(t, err)
+			tamperedPath := filepath.Join(t.TempDir(), "keystore")
+			require.NoError(t, os.WriteFile(tamperedPath, data, 0600))
+
+			_, err = ReadKeystore(tamperedPath, passphrase)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "invalid keystore kdf params")
+		})
+	}
+}
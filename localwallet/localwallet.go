@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/jsign/go-filsigner/wallet"
 )
@@ -12,9 +13,10 @@ var (
 	errPrivateKeyNotFound = errors.New("private key not found")
 )
 
-// Wallet is a container for Filecoin wallet addresses.
+// Wallet is a container for Filecoin wallet addresses. Addresses are matched
+// regardless of their network prefix.
 type Wallet struct {
-	keys map[string]string
+	keys map[address.Address]string
 }
 
 // New returns a new wallet.
@@ -22,13 +24,13 @@ func New(pks []string) (*Wallet, error) {
 	if len(pks) == 0 {
 		return nil, fmt.Errorf("at least one private key should be provided")
 	}
-	keys := map[string]string{}
+	keys := map[address.Address]string{}
 	for i := range pks {
 		pubKey, err := wallet.PublicKey(pks[i])
 		if err != nil {
 			return nil, fmt.Errorf("get public key from private key: %s", err)
 		}
-		keys[pubKey.String()] = pks[i]
+		keys[pubKey] = pks[i]
 	}
 	return &Wallet{
 		keys: keys,
@@ -37,14 +39,22 @@ func New(pks []string) (*Wallet, error) {
 
 // Has returns true if the wallet contains the private keys of addr.
 func (w *Wallet) Has(addr string) (bool, error) {
-	_, ok := w.keys[addr]
+	a, err := address.NewFromString(addr)
+	if err != nil {
+		return false, fmt.Errorf("parsing address: %s", err)
+	}
+	_, ok := w.keys[a]
 	return ok, nil
 }
 
 // Sign returns the signature of payload for wallet address addr.
 // If the wallet doesn't contain the private keys for addr, it returns an error.
 func (w *Wallet) Sign(addr string, payload []byte) (*crypto.Signature, error) {
-	pk, ok := w.keys[addr]
+	a, err := address.NewFromString(addr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing address: %s", err)
+	}
+	pk, ok := w.keys[a]
 	if !ok {
 		return nil, errPrivateKeyNotFound
 	}
@@ -58,10 +68,11 @@ func (w *Wallet) Sign(addr string, payload []byte) (*crypto.Signature, error) {
 }
 
 // GetAddresses returns all the addresses that the wallet contains its private keys.
+// Addresses are rendered with the prefix of address.CurrentNetwork.
 func (w *Wallet) GetAddresses() []string {
 	res := make([]string, 0, len(w.keys))
 	for addr := range w.keys {
-		res = append(res, addr)
+		res = append(res, addr.String())
 	}
 	return res
 }
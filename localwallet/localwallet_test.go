@@ -0,0 +1,29 @@
+package localwallet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressPrefixes(t *testing.T) {
+	t.Parallel()
+
+	pk, err := GenerateKey(KeyTypeSecp256k1)
+	require.NoError(t, err)
+	w, err := New([]string{pk})
+	require.NoError(t, err)
+	addr := w.GetAddresses()[0]
+
+	// The same address with mainnet and testnet prefixes.
+	for _, prefix := range []string{"f", "t"} {
+		ok, err := w.Has(prefix + addr[1:])
+		require.NoError(t, err)
+		require.True(t, ok)
+		_, err = w.Sign(prefix+addr[1:], []byte("payload"))
+		require.NoError(t, err)
+	}
+
+	_, err = w.Has("invalid")
+	require.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package lotuswallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	rpcPath = "/rpc/v0"
+
+	maxResponseSize = 1 << 20 // 1MiB
+)
+
+// Wallet signs with the keys of a Lotus node, using its JSON-RPC API.
+type Wallet struct {
+	// nextID is the first field to guarantee 64-bit alignment for atomic operations.
+	nextID uint64
+
+	url    string
+	token  string
+	client *http.Client
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// New returns a wallet that uses the Lotus API in api, which can be an HTTP URL
+// (e.g: http://127.0.0.1:1234/rpc/v0) or a multiaddr (e.g: /ip4/127.0.0.1/tcp/1234/http).
+// The token must have the sign permission, and requests fail after timeout.
+func New(api, token string, timeout time.Duration) (*Wallet, error) {
+	url, err := apiURL(api)
+	if err != nil {
+		return nil, fmt.Errorf("parsing lotus api: %s", err)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("lotus api token is empty")
+	}
+	return &Wallet{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Has returns true if the Lotus node contains the private keys of addr.
+func (w *Wallet) Has(addr string) (bool, error) {
+	var has bool
+	if err := w.call("Filecoin.WalletHas", []interface{}{addr}, &has); err != nil {
+		return false, err
+	}
+	return has, nil
+}
+
+// Sign returns the signature of payload for wallet address addr.
+func (w *Wallet) Sign(addr string, payload []byte) (*crypto.Signature, error) {
+	var sig crypto.Signature
+	if err := w.call("Filecoin.WalletSign", []interface{}{addr, payload}, &sig); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
+func (w *Wallet) call(method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      atomic.AddUint64(&w.nextID, 1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("marshaling %s request: %s", method, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating %s request: %s", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+w.token)
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling %s: %s", method, err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	resBody, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("reading %s response: %s", method, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("calling %s: lotus replied %s: %s", method, res.Status, strings.TrimSpace(string(resBody)))
+	}
+
+	var rpcRes rpcResponse
+	if err := json.Unmarshal(resBody, &rpcRes); err != nil {
+		return fmt.Errorf("unmarshaling %s response: %s", method, err)
+	}
+	if rpcRes.Error != nil {
+		return fmt.Errorf("%s failed (code %d): %s", method, rpcRes.Error.Code, rpcRes.Error.Message)
+	}
+	if err := json.Unmarshal(rpcRes.Result, result); err != nil {
+		return fmt.Errorf("unmarshaling %s result: %s", method, err)
+	}
+	return nil
+}
+
+func apiURL(api string) (string, error) {
+	if !strings.HasPrefix(api, "/") {
+		if !strings.HasPrefix(api, "http://") && !strings.HasPrefix(api, "https://") {
+			return "", fmt.Errorf("%q isn't an http url or multiaddr", api)
+		}
+		return api, nil
+	}
+
+	maddr, err := multiaddr.NewMultiaddr(api)
+	if err != nil {
+		return "", fmt.Errorf("parsing multiaddr: %s", err)
+	}
+	scheme := "http"
+	if rest, last := multiaddr.SplitLast(maddr); last != nil {
+		switch last.Protocol().Code {
+		case multiaddr.P_HTTP:
+			maddr = rest
+		case multiaddr.P_HTTPS:
+			scheme, maddr = "https", rest
+		}
+	}
+	_, host, err := manet.DialArgs(maddr)
+	if err != nil {
+		return "", fmt.Errorf("getting host from multiaddr: %s", err)
+	}
+	return scheme + "://" + host + rpcPath, nil
+}
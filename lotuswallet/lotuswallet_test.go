@@ -0,0 +1,109 @@
+package lotuswallet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/textileio/go-auctions-client/localwallet"
+)
+
+var (
+	walletKeys = []string{
+		// Secp256k1 exported private key in Lotus format.
+		"7b2254797065223a22736563703235366b31222c22507269766174654b6579223a226b35507976337148327349586343595a58594f5775453149326e32554539436861556b6c4e36695a5763453d227d", // nolint:lll
+		// BLS exported private key in Lotus format.
+		"7b2254797065223a22626c73222c22507269766174654b6579223a226862702f794666527439514c43716b6d566171415752436f50556777314b776971716e73684e49704e57513d227d", // nolint:lll
+	}
+)
+
+func TestHasAndSign(t *testing.T) {
+	t.Parallel()
+
+	local, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	srv := httptest.NewServer(newFakeLotus(t, "secrettoken", local))
+	defer srv.Close()
+
+	w, err := New(srv.URL+rpcPath, "secrettoken", time.Second)
+	require.NoError(t, err)
+	for _, addr := range local.GetAddresses() {
+		ok, err := w.Has(addr)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		sig, err := w.Sign(addr, []byte("payload"))
+		require.NoError(t, err)
+		expected, err := local.Sign(addr, []byte("payload"))
+		require.NoError(t, err)
+		require.Equal(t, expected, sig)
+	}
+
+	ok, err := w.Has("f01000")
+	require.NoError(t, err)
+	require.False(t, ok)
+	_, err = w.Sign("f01000", []byte("payload"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "private key not found")
+
+	w, err = New(srv.URL+rpcPath, "wrongtoken", time.Second)
+	require.NoError(t, err)
+	_, err = w.Has(local.GetAddresses()[0])
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+}
+
+func TestAPIURL(t *testing.T) {
+	t.Parallel()
+
+	url, err := apiURL("/ip4/127.0.0.1/tcp/1234/http")
+	require.NoError(t, err)
+	require.Equal(t, "http://127.0.0.1:1234/rpc/v0", url)
+	url, err = apiURL("/dns4/lotus.example.com/tcp/443/https")
+	require.NoError(t, err)
+	require.Equal(t, "https://lotus.example.com:443/rpc/v0", url)
+	url, err = apiURL("https://lotus.example.com/rpc/v0")
+	require.NoError(t, err)
+	require.Equal(t, "https://lotus.example.com/rpc/v0", url)
+	_, err = apiURL("lotus.example.com")
+	require.Error(t, err)
+}
+
+// newFakeLotus returns a handler that implements the Lotus wallet JSON-RPC methods with a local wallet.
+func newFakeLotus(t *testing.T, token string, local *localwallet.Wallet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			ID     uint64            `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		var addr string
+		require.NoError(t, json.Unmarshal(req.Params[0], &addr))
+
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "Filecoin.WalletHas":
+			res["result"], _ = local.Has(addr)
+		case "Filecoin.WalletSign":
+			var payload []byte
+			require.NoError(t, json.Unmarshal(req.Params[1], &payload))
+			sig, err := local.Sign(addr, payload)
+			if err != nil {
+				res["error"] = map[string]interface{}{"code": 1, "message": err.Error()}
+				break
+			}
+			res["result"] = sig
+		default:
+			res["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(res))
+	})
+}
@@ -0,0 +1,223 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/textileio/go-auctions-client/internal/addrkey"
+)
+
+const (
+	ruleMaxPricePerEpoch      = "max-price-per-epoch"
+	ruleMinPieceSize          = "min-piece-size"
+	ruleMaxPieceSize          = "max-piece-size"
+	ruleMinDuration           = "min-duration"
+	ruleMaxDuration           = "max-duration"
+	ruleVerifiedDeal          = "verified-deal"
+	ruleMinProviderCollateral = "min-provider-collateral"
+	ruleMaxProviderCollateral = "max-provider-collateral"
+	ruleLabelRegex            = "label-regex"
+	ruleAllowedProviders      = "allowed-providers"
+	ruleDeniedProviders       = "denied-providers"
+)
+
+// Config is the user-facing configuration of the rules of a wallet address.
+// Token amounts are expressed in attoFIL as strings, and durations in epochs.
+// Zero values mean that the rule isn't enforced.
+type Config struct {
+	MaxPricePerEpoch      string   `mapstructure:"max-price-per-epoch"`
+	MinPieceSize          uint64   `mapstructure:"min-piece-size"`
+	MaxPieceSize          uint64   `mapstructure:"max-piece-size"`
+	MinDuration           int64    `mapstructure:"min-duration"`
+	MaxDuration           int64    `mapstructure:"max-duration"`
+	VerifiedDeal          *bool    `mapstructure:"verified-deal"`
+	MinProviderCollateral string   `mapstructure:"min-provider-collateral"`
+	MaxProviderCollateral string   `mapstructure:"max-provider-collateral"`
+	LabelRegex            string   `mapstructure:"label-regex"`
+	AllowedProviders      []string `mapstructure:"allowed-providers"`
+	DeniedProviders       []string `mapstructure:"denied-providers"`
+}
+
+// Rules are the conditions that a deal proposal must satisfy to be signed.
+type Rules struct {
+	maxPricePerEpoch      *abi.TokenAmount
+	minPieceSize          abi.PaddedPieceSize
+	maxPieceSize          abi.PaddedPieceSize
+	minDuration           abi.ChainEpoch
+	maxDuration           abi.ChainEpoch
+	verifiedDeal          *bool
+	minProviderCollateral *abi.TokenAmount
+	maxProviderCollateral *abi.TokenAmount
+	labelRegex            *regexp.Regexp
+	allowedProviders      map[address.Address]struct{}
+	deniedProviders       map[address.Address]struct{}
+}
+
+// NewRules validates the configuration and returns the corresponding rules.
+func NewRules(cfg Config) (Rules, error) {
+	var err error
+	r := Rules{
+		minPieceSize: abi.PaddedPieceSize(cfg.MinPieceSize),
+		maxPieceSize: abi.PaddedPieceSize(cfg.MaxPieceSize),
+		minDuration:  abi.ChainEpoch(cfg.MinDuration),
+		maxDuration:  abi.ChainEpoch(cfg.MaxDuration),
+		verifiedDeal: cfg.VerifiedDeal,
+	}
+	if r.maxPricePerEpoch, err = parseTokenAmount(cfg.MaxPricePerEpoch); err != nil {
+		return Rules{}, fmt.Errorf("parsing %s: %s", ruleMaxPricePerEpoch, err)
+	}
+	if r.minProviderCollateral, err = parseTokenAmount(cfg.MinProviderCollateral); err != nil {
+		return Rules{}, fmt.Errorf("parsing %s: %s", ruleMinProviderCollateral, err)
+	}
+	if r.maxProviderCollateral, err = parseTokenAmount(cfg.MaxProviderCollateral); err != nil {
+		return Rules{}, fmt.Errorf("parsing %s: %s", ruleMaxProviderCollateral, err)
+	}
+	if cfg.LabelRegex != "" {
+		if r.labelRegex, err = regexp.Compile(cfg.LabelRegex); err != nil {
+			return Rules{}, fmt.Errorf("parsing %s: %s", ruleLabelRegex, err)
+		}
+	}
+	if r.allowedProviders, err = addrkey.ParseSet(cfg.AllowedProviders); err != nil {
+		return Rules{}, fmt.Errorf("parsing %s: %s", ruleAllowedProviders, err)
+	}
+	if r.deniedProviders, err = addrkey.ParseSet(cfg.DeniedProviders); err != nil {
+		return Rules{}, fmt.Errorf("parsing %s: %s", ruleDeniedProviders, err)
+	}
+	if r.minPieceSize > 0 && r.maxPieceSize > 0 && r.minPieceSize > r.maxPieceSize {
+		return Rules{}, fmt.Errorf("%s is greater than %s", ruleMinPieceSize, ruleMaxPieceSize)
+	}
+	if r.minDuration > 0 && r.maxDuration > 0 && r.minDuration > r.maxDuration {
+		return Rules{}, fmt.Errorf("%s is greater than %s", ruleMinDuration, ruleMaxDuration)
+	}
+
+	return r, nil
+}
+
+// Check returns an error explaining the first rule that the deal proposal doesn't satisfy.
+// labelBytes is non-nil if the proposal label is raw bytes instead of a string.
+func (r Rules) Check(proposal market.DealProposal, labelBytes []byte) error {
+	if _, ok := r.deniedProviders[proposal.Provider]; ok {
+		return fmt.Errorf("%s: storage-provider %s is refused since it's in the denylist",
+			ruleDeniedProviders, proposal.Provider)
+	}
+	if _, ok := r.allowedProviders[proposal.Provider]; r.allowedProviders != nil && !ok {
+		return fmt.Errorf("%s: storage-provider %s is refused since it isn't in the allowlist",
+			ruleAllowedProviders, proposal.Provider)
+	}
+	if r.maxPricePerEpoch != nil && proposal.StoragePricePerEpoch.GreaterThan(*r.maxPricePerEpoch) {
+		return fmt.Errorf("%s: storage price per epoch %s is greater than %s",
+			ruleMaxPricePerEpoch, proposal.StoragePricePerEpoch, r.maxPricePerEpoch)
+	}
+	if r.minPieceSize > 0 && proposal.PieceSize < r.minPieceSize {
+		return fmt.Errorf("%s: piece size %d is smaller than %d", ruleMinPieceSize, proposal.PieceSize, r.minPieceSize)
+	}
+	if r.maxPieceSize > 0 && proposal.PieceSize > r.maxPieceSize {
+		return fmt.Errorf("%s: piece size %d is greater than %d", ruleMaxPieceSize, proposal.PieceSize, r.maxPieceSize)
+	}
+	duration := proposal.Duration()
+	if r.minDuration > 0 && duration < r.minDuration {
+		return fmt.Errorf("%s: duration %d is shorter than %d epochs", ruleMinDuration, duration, r.minDuration)
+	}
+	if r.maxDuration > 0 && duration > r.maxDuration {
+		return fmt.Errorf("%s: duration %d is longer than %d epochs", ruleMaxDuration, duration, r.maxDuration)
+	}
+	if r.verifiedDeal != nil && proposal.VerifiedDeal != *r.verifiedDeal {
+		return fmt.Errorf("%s: verified deal is %t but only %t is allowed",
+			ruleVerifiedDeal, proposal.VerifiedDeal, *r.verifiedDeal)
+	}
+	if r.minProviderCollateral != nil && proposal.ProviderCollateral.LessThan(*r.minProviderCollateral) {
+		return fmt.Errorf("%s: provider collateral %s is smaller than %s",
+			ruleMinProviderCollateral, proposal.ProviderCollateral, r.minProviderCollateral)
+	}
+	if r.maxProviderCollateral != nil && proposal.ProviderCollateral.GreaterThan(*r.maxProviderCollateral) {
+		return fmt.Errorf("%s: provider collateral %s is greater than %s",
+			ruleMaxProviderCollateral, proposal.ProviderCollateral, r.maxProviderCollateral)
+	}
+	// Bytes labels might not be valid strings, so they can't match the regex.
+	if r.labelRegex != nil && labelBytes != nil {
+		return fmt.Errorf("%s: label is bytes instead of a string", ruleLabelRegex)
+	}
+	if r.labelRegex != nil && !r.labelRegex.MatchString(proposal.Label) {
+		return fmt.Errorf("%s: label %q doesn't match %q", ruleLabelRegex, proposal.Label, r.labelRegex)
+	}
+
+	return nil
+}
+
+// Engine evaluates deal proposals against the rules configured for their client address.
+// Proposals for addresses without configured rules are allowed.
+type Engine struct {
+	lock  sync.RWMutex
+	rules map[address.Address]Rules
+}
+
+// New returns a new policy engine from the per wallet address configuration.
+func New(cfgs map[string]Config) (*Engine, error) {
+	rules, err := newRulesByAddress(cfgs)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		rules: rules,
+	}, nil
+}
+
+// Update replaces the rules of the engine with a new configuration. If the new
+// configuration is invalid, the current rules are kept.
+func (e *Engine) Update(cfgs map[string]Config) error {
+	rules, err := newRulesByAddress(cfgs)
+	if err != nil {
+		return err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.rules = rules
+
+	return nil
+}
+
+// Check returns an error if the deal proposal doesn't satisfy the rules of its client address.
+func (e *Engine) Check(proposal market.DealProposal, labelBytes []byte) error {
+	e.lock.RLock()
+	r, ok := e.rules[proposal.Client]
+	e.lock.RUnlock()
+	if !ok {
+		return nil
+	}
+	return r.Check(proposal, labelBytes)
+}
+
+func newRulesByAddress(cfgs map[string]Config) (map[address.Address]Rules, error) {
+	rules := make(map[address.Address]Rules, len(cfgs))
+	for a, cfg := range cfgs {
+		addr, err := addrkey.Parse(a)
+		if err != nil {
+			return nil, err
+		}
+		r, err := NewRules(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("creating rules for %s: %s", a, err)
+		}
+		rules[addr] = r
+	}
+	return rules, nil
+}
+
+func parseTokenAmount(s string) (*abi.TokenAmount, error) {
+	if s == "" {
+		return nil, nil
+	}
+	amount, err := big.FromString(s)
+	if err != nil {
+		return nil, err
+	}
+	if amount.Sign() < 0 {
+		return nil, fmt.Errorf("amount can't be negative")
+	}
+	return &amount, nil
+}
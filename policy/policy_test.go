@@ -0,0 +1,195 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules(t *testing.T) {
+	t.Parallel()
+
+	verified := true
+	cfg := Config{
+		MaxPricePerEpoch:      "1000",
+		MinPieceSize:          512,
+		MaxPieceSize:          2048,
+		MinDuration:           100,
+		MaxDuration:           200,
+		VerifiedDeal:          &verified,
+		MinProviderCollateral: "10",
+		MaxProviderCollateral: "100",
+		LabelRegex:            "^bafy",
+	}
+	rules, err := NewRules(cfg)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		modify func(p *market.DealProposal)
+		rule   string
+	}{
+		{name: "valid", modify: func(p *market.DealProposal) {}},
+		{
+			name:   "price",
+			modify: func(p *market.DealProposal) { p.StoragePricePerEpoch = big.NewInt(1001) },
+			rule:   ruleMaxPricePerEpoch,
+		},
+		{name: "small piece", modify: func(p *market.DealProposal) { p.PieceSize = 256 }, rule: ruleMinPieceSize},
+		{name: "big piece", modify: func(p *market.DealProposal) { p.PieceSize = 4096 }, rule: ruleMaxPieceSize},
+		{
+			name:   "short duration",
+			modify: func(p *market.DealProposal) { p.EndEpoch = p.StartEpoch + 50 },
+			rule:   ruleMinDuration,
+		},
+		{
+			name:   "long duration",
+			modify: func(p *market.DealProposal) { p.EndEpoch = p.StartEpoch + 500 },
+			rule:   ruleMaxDuration,
+		},
+		{name: "unverified", modify: func(p *market.DealProposal) { p.VerifiedDeal = false }, rule: ruleVerifiedDeal},
+		{
+			name:   "low collateral",
+			modify: func(p *market.DealProposal) { p.ProviderCollateral = big.NewInt(1) },
+			rule:   ruleMinProviderCollateral,
+		},
+		{
+			name:   "high collateral",
+			modify: func(p *market.DealProposal) { p.ProviderCollateral = big.NewInt(101) },
+			rule:   ruleMaxProviderCollateral,
+		},
+		{name: "label", modify: func(p *market.DealProposal) { p.Label = "other" }, rule: ruleLabelRegex},
+	}
+	for _, test := range testCases {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			proposal := validProposal(t)
+			test.modify(&proposal)
+			err := rules.Check(proposal, nil)
+			if test.rule == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.rule)
+		})
+	}
+
+	t.Run("bytes label", func(t *testing.T) {
+		t.Parallel()
+		proposal := validProposal(t)
+		proposal.Label = ""
+		err := rules.Check(proposal, []byte("bafyfakelabel"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), ruleLabelRegex)
+
+		noRegex, err := NewRules(Config{})
+		require.NoError(t, err)
+		require.NoError(t, noRegex.Check(proposal, []byte{0xff, 0x00}))
+	})
+}
+
+func TestProviderLists(t *testing.T) {
+	t.Parallel()
+
+	proposal := validProposal(t)
+	allowed, err := NewRules(Config{AllowedProviders: []string{proposal.Provider.String()}})
+	require.NoError(t, err)
+	require.NoError(t, allowed.Check(proposal, nil))
+
+	denied, err := NewRules(Config{DeniedProviders: []string{proposal.Provider.String()}})
+	require.NoError(t, err)
+	err = denied.Check(proposal, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ruleDeniedProviders)
+
+	other, err := address.NewIDAddress(4321)
+	require.NoError(t, err)
+	proposal.Provider = other
+	err = allowed.Check(proposal, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ruleAllowedProviders)
+	require.NoError(t, denied.Check(proposal, nil))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewRules(Config{MaxPricePerEpoch: "notanumber"})
+	require.Error(t, err)
+	_, err = NewRules(Config{MinProviderCollateral: "-1"})
+	require.Error(t, err)
+	_, err = NewRules(Config{LabelRegex: "("})
+	require.Error(t, err)
+	_, err = NewRules(Config{MinDuration: 10, MaxDuration: 5})
+	require.Error(t, err)
+	_, err = NewRules(Config{AllowedProviders: []string{"notanaddress"}})
+	require.Error(t, err)
+}
+
+func TestEngine(t *testing.T) {
+	t.Parallel()
+
+	proposal := validProposal(t)
+	e, err := New(map[string]Config{
+		proposal.Client.String(): {MaxPricePerEpoch: "10"},
+	})
+	require.NoError(t, err)
+	require.Error(t, e.Check(proposal, nil))
+
+	other, err := address.NewIDAddress(1234)
+	require.NoError(t, err)
+	proposal.Client = other
+	require.NoError(t, e.Check(proposal, nil))
+
+	err = e.Update(map[string]Config{
+		other.String(): {DeniedProviders: []string{proposal.Provider.String()}},
+	})
+	require.NoError(t, err)
+	require.Error(t, e.Check(proposal, nil))
+
+	err = e.Update(map[string]Config{other.String(): {MaxPricePerEpoch: "invalid"}})
+	require.Error(t, err)
+	require.Error(t, e.Check(proposal, nil))
+
+	err = e.Update(map[string]Config{"notanaddress": {MaxPricePerEpoch: "10"}})
+	require.Error(t, err)
+}
+
+// TestEngineNetworkPrefix isn't parallel, since it changes the current network.
+func TestEngineNetworkPrefix(t *testing.T) {
+	defer func(n address.Network) { address.CurrentNetwork = n }(address.CurrentNetwork)
+	address.CurrentNetwork = address.Testnet
+
+	// Rules configured with the mainnet prefix apply to calibration proposals.
+	proposal := validProposal(t)
+	e, err := New(map[string]Config{
+		address.MainnetPrefix + proposal.Client.String()[1:]: {MaxPricePerEpoch: "10"},
+	})
+	require.NoError(t, err)
+	require.Error(t, e.Check(proposal, nil))
+}
+
+func validProposal(t *testing.T) market.DealProposal {
+	client, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	provider, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	return market.DealProposal{
+		PieceSize:            1024,
+		VerifiedDeal:         true,
+		Client:               client,
+		Provider:             provider,
+		Label:                "bafyfakelabel",
+		StartEpoch:           100,
+		EndEpoch:             250,
+		StoragePricePerEpoch: big.NewInt(500),
+		ProviderCollateral:   big.NewInt(50),
+		ClientCollateral:     big.Zero(),
+	}
+}
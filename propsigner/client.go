@@ -3,29 +3,104 @@ package propsigner
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/filecoin-project/go-address"
+	marketv8 "github.com/filecoin-project/go-state-types/builtin/v8/market"
 	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/google/uuid"
 	"github.com/jsign/go-filsigner/wallet"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
 	pb "github.com/textileio/go-auctions-client/gen/wallet"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	maxResponseMessageSize = 100 << 10
 )
 
+var (
+	// ErrInvalidToken means the remote wallet didn't authorize the request.
+	ErrInvalidToken = errors.New("invalid auth token")
+	// ErrReplayedRequest means the remote wallet considered the request stale or replayed, for example
+	// because the clocks are skewed.
+	ErrReplayedRequest = errors.New("stale or replayed request")
+	// ErrUnknownAddress means the remote wallet doesn't have keys for the wallet address.
+	ErrUnknownAddress = errors.New("unknown wallet address")
+	// ErrPolicyRejected means a policy, spending budget or operator of the remote wallet rejected the request.
+	ErrPolicyRejected = errors.New("rejected by policy")
+	// ErrUnsupportedProtocol means the remote wallet doesn't support the filecoin deal protocol.
+	ErrUnsupportedProtocol = errors.New("unsupported filecoin deal protocol")
+	// ErrMalformedPayload means the remote wallet couldn't decode the request, or found it inconsistent.
+	ErrMalformedPayload = errors.New("malformed payload")
+	// ErrInternal means the remote wallet failed to sign a valid request.
+	ErrInternal = errors.New("remote wallet internal error")
+	// ErrRateLimited means the remote wallet asked to retry the request later.
+	ErrRateLimited = errors.New("rate limited")
+
+	errorCodeSentinels = map[pb.ErrorCode]error{
+		pb.ErrorCode_ERROR_CODE_INVALID_TOKEN:        ErrInvalidToken,
+		pb.ErrorCode_ERROR_CODE_REPLAYED_REQUEST:     ErrReplayedRequest,
+		pb.ErrorCode_ERROR_CODE_UNKNOWN_ADDRESS:      ErrUnknownAddress,
+		pb.ErrorCode_ERROR_CODE_POLICY_REJECTED:      ErrPolicyRejected,
+		pb.ErrorCode_ERROR_CODE_UNSUPPORTED_PROTOCOL: ErrUnsupportedProtocol,
+		pb.ErrorCode_ERROR_CODE_MALFORMED_PAYLOAD:    ErrMalformedPayload,
+		pb.ErrorCode_ERROR_CODE_INTERNAL:             ErrInternal,
+		pb.ErrorCode_ERROR_CODE_RATE_LIMITED:         ErrRateLimited,
+	}
+)
+
+// responseError is an error replied by the remote wallet. It matches the sentinel error of
+// its code with errors.Is, unless the remote wallet didn't classify it.
+type responseError struct {
+	code error
+	msg  string
+}
+
+func (e *responseError) Error() string {
+	return "response managed error: " + e.msg
+}
+
+func (e *responseError) Unwrap() error {
+	return e.code
+}
+
+// unsentError is a failure before the signing request was fully written, so the remote
+// wallet couldn't have signed it.
+type unsentError struct {
+	err error
+}
+
+func (e *unsentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unsentError) Unwrap() error {
+	return e.err
+}
+
+// isRetryable reports if a failed signing request can be retried. Only requests that weren't
+// fully sent are retried, since otherwise the remote wallet might have signed them already.
+// Errors replied by the remote wallet are permanent, unless it asked to retry later.
+func isRetryable(err error) bool {
+	var unsentErr *unsentError
+	return errors.As(err, &unsentErr) || errors.Is(err, ErrRateLimited)
+}
+
 // RequestDealProposalSignatureV1 request a signature for a deal proposal to a remote wallet.
 func RequestDealProposalSignatureV1(
 	ctx context.Context,
 	h host.Host,
 	authToken string,
 	proposal market.DealProposal,
-	rwPeerID peer.ID) (*crypto.Signature, error) {
+	rwPeerID peer.ID,
+	opts ...ClientOption) (*crypto.Signature, error) {
 	proposalCborBytes := &bytes.Buffer{}
 	if err := proposal.MarshalCBOR(proposalCborBytes); err != nil {
 		return nil, fmt.Errorf("marshaling deal proposal to cbor: %s", err)
@@ -38,9 +113,9 @@ func RequestDealProposalSignatureV1(
 		Payload:              proposalCborBytes.Bytes(),
 	}
 
-	sig, err := sendToRemoteWallet(ctx, h, rwPeerID, req)
+	sig, err := sendToRemoteWallet(ctx, h, rwPeerID, req, opts)
 	if err != nil {
-		return nil, fmt.Errorf("sending signing request to wallet: %s", err)
+		return nil, fmt.Errorf("sending signing request to wallet: %w", err)
 	}
 
 	if err := ValidateDealProposalSignature(proposal, sig); err != nil {
@@ -50,6 +125,39 @@ func RequestDealProposalSignatureV1(
 	return sig, nil
 }
 
+// RequestDealProposalSignatureV2 request a signature for a deal proposal with a string or bytes
+// label, as sent with the /fil/storage/mk/1.2.0 protocol, to a remote wallet.
+func RequestDealProposalSignatureV2(
+	ctx context.Context,
+	h host.Host,
+	authToken string,
+	proposal marketv8.DealProposal,
+	rwPeerID peer.ID,
+	opts ...ClientOption) (*crypto.Signature, error) {
+	proposalCborBytes := &bytes.Buffer{}
+	if err := proposal.MarshalCBOR(proposalCborBytes); err != nil {
+		return nil, fmt.Errorf("marshaling deal proposal to cbor: %s", err)
+	}
+
+	req := &pb.SigningRequest{
+		AuthToken:            authToken,
+		WalletAddress:        proposal.Client.String(),
+		FilecoinDealProtocol: filDealProposalProtocolV2,
+		Payload:              proposalCborBytes.Bytes(),
+	}
+
+	sig, err := sendToRemoteWallet(ctx, h, rwPeerID, req, opts)
+	if err != nil {
+		return nil, fmt.Errorf("sending signing request to wallet: %w", err)
+	}
+
+	if err := ValidateDealProposalSignatureV2(proposal, sig); err != nil {
+		return nil, fmt.Errorf("validating signature: %s", err)
+	}
+
+	return sig, nil
+}
+
 // RequestDealStatusSignatureV1 request a signature for a deal status request to a remote wallet.
 func RequestDealStatusSignatureV1(
 	ctx context.Context,
@@ -57,7 +165,8 @@ func RequestDealStatusSignatureV1(
 	authToken string,
 	walletAddr string,
 	payload []byte,
-	rwPeerID peer.ID) (*crypto.Signature, error) {
+	rwPeerID peer.ID,
+	opts ...ClientOption) (*crypto.Signature, error) {
 	req := &pb.SigningRequest{
 		AuthToken:            authToken,
 		WalletAddress:        walletAddr,
@@ -65,9 +174,9 @@ func RequestDealStatusSignatureV1(
 		Payload:              payload,
 	}
 
-	sig, err := sendToRemoteWallet(ctx, h, rwPeerID, req)
+	sig, err := sendToRemoteWallet(ctx, h, rwPeerID, req, opts)
 	if err != nil {
-		return nil, fmt.Errorf("sending signing request to wallet: %s", err)
+		return nil, fmt.Errorf("sending signing request to wallet: %w", err)
 	}
 
 	return sig, nil
@@ -77,10 +186,61 @@ func sendToRemoteWallet(
 	ctx context.Context,
 	h host.Host,
 	rwPeerID peer.ID,
-	req *pb.SigningRequest) (*crypto.Signature, error) {
-	s, err := h.NewStream(network.WithUseTransient(ctx, "relayed"), rwPeerID, v1Protocol)
+	req *pb.SigningRequest,
+	opts []ClientOption) (*crypto.Signature, error) {
+	cfg, err := newClientConfig(opts)
+	if err != nil {
+		return nil, fmt.Errorf("configuring client: %s", err)
+	}
+	direct, relayed, err := cfg.splitAddrs(rwPeerID)
 	if err != nil {
-		return nil, fmt.Errorf("creating libp2p stream: %s", err)
+		return nil, fmt.Errorf("configuring client: %s", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		// Each attempt is a new request, with its own timestamp and nonce.
+		attemptReq := proto.Clone(req).(*pb.SigningRequest)
+		sig, err := sendAttempt(ctx, h, rwPeerID, attemptReq, cfg, direct, relayed)
+		if err == nil {
+			return sig, nil
+		}
+		if !isRetryable(err) || attempt >= cfg.retry.MaxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+		backoff := cfg.retry.backoff(attempt)
+		log.Debugf("signing request attempt %d to %s failed, retrying in %s: %s", attempt, rwPeerID, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+func sendAttempt(
+	ctx context.Context,
+	h host.Host,
+	rwPeerID peer.ID,
+	req *pb.SigningRequest,
+	cfg clientConfig,
+	direct, relayed []multiaddr.Multiaddr) (*crypto.Signature, error) {
+	if err := cfg.connect(ctx, h, rwPeerID, direct, relayed); err != nil {
+		return nil, &unsentError{err: fmt.Errorf("connecting to remote wallet: %s", err)}
+	}
+
+	req.Timestamp = time.Now().Unix()
+	req.Nonce = uuid.New().String()
+
+	s, err := h.NewStream(network.WithUseTransient(ctx, "relayed"), rwPeerID, v2Protocol, v1Protocol)
+	if err != nil {
+		return nil, &unsentError{err: fmt.Errorf("creating libp2p stream: %s", err)}
+	}
+	path := connectionPath(s.Conn())
+	log.Debugf("reached remote wallet %s through a %s connection", rwPeerID, path)
+	if cfg.reportPath != nil {
+		cfg.reportPath(path)
 	}
 	defer func() {
 		if err := s.Close(); err != nil {
@@ -88,8 +248,13 @@ func sendToRemoteWallet(
 		}
 	}()
 
-	if err := writeMsg(s, req); err != nil {
-		return nil, fmt.Errorf("sending deal signing request to stream: %s", err)
+	// Remote wallets that don't support v2 yet receive the auth token in the request.
+	if s.Protocol() == v2Protocol {
+		if err := writeAuthenticatedRequest(s, req); err != nil {
+			return nil, &unsentError{err: fmt.Errorf("sending authenticated deal signing request to stream: %s", err)}
+		}
+	} else if err := writeMsg(s, req); err != nil {
+		return nil, &unsentError{err: fmt.Errorf("sending deal signing request to stream: %s", err)}
 	}
 
 	var res pb.SigningResponse
@@ -98,17 +263,44 @@ func sendToRemoteWallet(
 	}
 
 	if res.Error != "" {
-		return nil, fmt.Errorf("response managed error: %s", res.Error)
+		return nil, &responseError{code: errorCodeSentinels[res.ErrorCode], msg: res.Error}
 	}
 
 	var sig crypto.Signature
 	if err := sig.UnmarshalBinary(res.Signature); err != nil {
-		return nil, fmt.Errorf("unmarshaling signature cbor bytes: %s", err)
+		return nil, &responseError{code: ErrInternal, msg: fmt.Sprintf("unmarshaling signature cbor bytes: %s", err)}
 	}
 
 	return &sig, nil
 }
 
+// writeAuthenticatedRequest answers the remote wallet challenge with the request, proving
+// knowing the auth token without sending it.
+func writeAuthenticatedRequest(s network.Stream, req *pb.SigningRequest) error {
+	var challenge pb.AuthChallenge
+	if err := readMsg(s, maxResponseMessageSize, &challenge); err != nil {
+		return fmt.Errorf("unmarshaling challenge: %s", err)
+	}
+	if len(challenge.Challenge) < challengeSize {
+		return fmt.Errorf("challenge is too short")
+	}
+
+	authToken := req.AuthToken
+	req.AuthToken = ""
+	reqBytes, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("marshaling signing request: %s", err)
+	}
+	authReq := &pb.AuthenticatedSigningRequest{
+		Request: reqBytes,
+		Hmac:    requestHMAC(authToken, challenge.Challenge, reqBytes),
+	}
+	if err := writeMsg(s, authReq); err != nil {
+		return fmt.Errorf("writing authenticated request: %s", err)
+	}
+	return nil
+}
+
 // ValidateDealProposalSignature validates that the signature is valid for the provided deal proposal.
 func ValidateDealProposalSignature(proposal market.DealProposal, sig *crypto.Signature) error {
 	msg := &bytes.Buffer{}
@@ -116,31 +308,35 @@ func ValidateDealProposalSignature(proposal market.DealProposal, sig *crypto.Sig
 	if err != nil {
 		return fmt.Errorf("marshaling proposal: %s", err)
 	}
-	sigBytes, err := sig.MarshalBinary()
-	if err != nil {
-		return fmt.Errorf("marshaling signature: %s", err)
-	}
-	ok, err := wallet.WalletVerify(proposal.Client, msg.Bytes(), sigBytes)
+	return verifySignature(proposal.Client, msg.Bytes(), sig)
+}
+
+// ValidateDealProposalSignatureV2 validates that the signature is valid for the provided deal proposal
+// with a string or bytes label.
+func ValidateDealProposalSignatureV2(proposal marketv8.DealProposal, sig *crypto.Signature) error {
+	msg := &bytes.Buffer{}
+	err := proposal.MarshalCBOR(msg)
 	if err != nil {
-		return fmt.Errorf("verifying signature: %s", err)
-	}
-	if !ok {
-		return fmt.Errorf("signature is invalid")
+		return fmt.Errorf("marshaling proposal: %s", err)
 	}
-	return nil
+	return verifySignature(proposal.Client, msg.Bytes(), sig)
 }
 
 // ValidateDealStatusSignature validates that the signature is valid for the payload.
 func ValidateDealStatusSignature(walletAddr string, payload []byte, sig *crypto.Signature) error {
-	sigBytes, err := sig.MarshalBinary()
-	if err != nil {
-		return fmt.Errorf("marshaling signature: %s", err)
-	}
 	waddr, err := address.NewFromString(walletAddr)
 	if err != nil {
 		return fmt.Errorf("parsing wallet address: %s", err)
 	}
-	ok, err := wallet.WalletVerify(waddr, payload, sigBytes)
+	return verifySignature(waddr, payload, sig)
+}
+
+func verifySignature(addr address.Address, msg []byte, sig *crypto.Signature) error {
+	sigBytes, err := sig.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("marshaling signature: %s", err)
+	}
+	ok, err := wallet.WalletVerify(addr, msg, sigBytes)
 	if err != nil {
 		return fmt.Errorf("verifying signature: %s", err)
 	}
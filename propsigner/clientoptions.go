@@ -0,0 +1,194 @@
+package propsigner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/textileio/go-auctions-client/internal/backoff"
+)
+
+// ConnectionPath is the network path used to reach a remote wallet.
+type ConnectionPath string
+
+const (
+	// ConnectionPathDirect is a direct connection with the remote wallet.
+	ConnectionPathDirect ConnectionPath = "direct"
+	// ConnectionPathRelayed is a connection with the remote wallet through a libp2p relay.
+	ConnectionPathRelayed ConnectionPath = "relayed"
+)
+
+var (
+	defaultDirectDialTimeout = 10 * time.Second
+)
+
+// RetryPolicy configures how signing requests that fail before being fully sent are retried.
+// Requests that fail afterwards, such as reading the response, aren't retried since the
+// remote wallet might have signed them already. Neither are errors returned by the remote
+// wallet, such as an invalid auth token, unless it asked to retry later with ErrRateLimited.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, which doubles with each retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each wait, between 0 and 1, that is randomized.
+	Jitter float64
+}
+
+// backoff returns the wait after the failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	return backoff.Exponential(p.InitialBackoff, p.MaxBackoff, p.Jitter, attempt)
+}
+
+type clientConfig struct {
+	addrs             []multiaddr.Multiaddr
+	addrsTTL          time.Duration
+	directDialTimeout time.Duration
+	reportPath        func(ConnectionPath)
+	retry             RetryPolicy
+}
+
+// ClientOption configures signing requests sent to a remote wallet.
+type ClientOption func(*clientConfig) error
+
+// WithRemoteWalletAddrs provides the direct and relayed (/p2p-circuit) multiaddrs of the
+// remote wallet, which are added to the peerstore for ttl. Direct multiaddrs are dialed
+// first, and relayed ones are only dialed if a direct connection can't be established.
+// Multiaddrs can optionally end with the /p2p component of the remote wallet.
+func WithRemoteWalletAddrs(ttl time.Duration, addrs ...multiaddr.Multiaddr) ClientOption {
+	return func(c *clientConfig) error {
+		if len(addrs) == 0 {
+			return fmt.Errorf("remote wallet multiaddrs list is empty")
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("multiaddrs ttl must be positive")
+		}
+		c.addrs = append(c.addrs, addrs...)
+		c.addrsTTL = ttl
+		return nil
+	}
+}
+
+// WithDirectDialTimeout limits the time spent dialing direct multiaddrs before falling
+// back to relayed ones. The default is 10 seconds.
+func WithDirectDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *clientConfig) error {
+		if timeout <= 0 {
+			return fmt.Errorf("direct dial timeout must be positive")
+		}
+		c.directDialTimeout = timeout
+		return nil
+	}
+}
+
+// WithConnectionPathReport calls report with the path used to reach the remote wallet.
+func WithConnectionPathReport(report func(ConnectionPath)) ClientOption {
+	return func(c *clientConfig) error {
+		if report == nil {
+			return fmt.Errorf("report function is nil")
+		}
+		c.reportPath = report
+		return nil
+	}
+}
+
+// WithRetryPolicy retries signing requests that fail before being fully sent, such as
+// failing to dial or open a stream with a relayed remote wallet, and requests rate limited
+// by the remote wallet. By default, requests aren't retried.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *clientConfig) error {
+		if policy.MaxAttempts < 1 {
+			return fmt.Errorf("max attempts must be at least 1")
+		}
+		if policy.InitialBackoff <= 0 || policy.MaxBackoff < policy.InitialBackoff {
+			return fmt.Errorf("backoffs must be positive and max backoff can't be less than initial backoff")
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return fmt.Errorf("jitter must be between 0 and 1")
+		}
+		c.retry = policy
+		return nil
+	}
+}
+
+func newClientConfig(opts []ClientOption) (clientConfig, error) {
+	cfg := clientConfig{
+		directDialTimeout: defaultDirectDialTimeout,
+		retry:             RetryPolicy{MaxAttempts: 1},
+	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return clientConfig{}, fmt.Errorf("applying option: %s", err)
+		}
+	}
+	return cfg, nil
+}
+
+// splitAddrs returns the configured direct and relayed multiaddrs of the remote wallet,
+// without their /p2p component.
+func (c clientConfig) splitAddrs(rwPeerID peer.ID) ([]multiaddr.Multiaddr, []multiaddr.Multiaddr, error) {
+	var direct, relayed []multiaddr.Multiaddr
+	for _, addr := range c.addrs {
+		transport, id := peer.SplitAddr(addr)
+		if id != "" && id != rwPeerID {
+			return nil, nil, fmt.Errorf("multiaddr %s doesn't belong to remote wallet %s", addr, rwPeerID)
+		}
+		if isRelayedAddr(transport) {
+			relayed = append(relayed, transport)
+		} else {
+			direct = append(direct, transport)
+		}
+	}
+	return direct, relayed, nil
+}
+
+// connect connects with the remote wallet through its multiaddrs, preferring direct
+// ones. If there are no multiaddrs, the peerstore must know how to reach it.
+func (c clientConfig) connect(
+	ctx context.Context,
+	h host.Host,
+	rwPeerID peer.ID,
+	direct, relayed []multiaddr.Multiaddr) error {
+	if len(direct)+len(relayed) == 0 {
+		return nil
+	}
+
+	if len(direct) > 0 {
+		h.Peerstore().AddAddrs(rwPeerID, direct, c.addrsTTL)
+		// Forcing a direct dial skips relayed multiaddrs and existing relayed connections.
+		dialCtx, cancel := context.WithTimeout(ctx, c.directDialTimeout)
+		err := h.Connect(network.WithForceDirectDial(dialCtx, "direct-first"), peer.AddrInfo{ID: rwPeerID})
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if len(relayed) == 0 {
+			return fmt.Errorf("dialing direct multiaddrs: %s", err)
+		}
+		log.Debugf("dialing remote wallet %s direct multiaddrs failed, trying relayed ones: %s", rwPeerID, err)
+	}
+
+	h.Peerstore().AddAddrs(rwPeerID, relayed, c.addrsTTL)
+	if err := h.Connect(ctx, peer.AddrInfo{ID: rwPeerID}); err != nil {
+		return fmt.Errorf("dialing relayed multiaddrs: %s", err)
+	}
+	return nil
+}
+
+func connectionPath(conn network.Conn) ConnectionPath {
+	if isRelayedAddr(conn.RemoteMultiaddr()) {
+		return ConnectionPathRelayed
+	}
+	return ConnectionPathDirect
+}
+
+func isRelayedAddr(addr multiaddr.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(multiaddr.P_CIRCUIT)
+	return err == nil
+}
@@ -0,0 +1,95 @@
+package propsigner
+
+import (
+	"errors"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	outcomeSigned = "signed"
+	outcomeFailed = "failed"
+)
+
+var (
+	metricRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auc_signer_requests_total",
+		Help: "Handled signing requests by signer protocol, filecoin deal protocol, outcome and error reason",
+	}, []string{"protocol", "deal_protocol", "outcome", "reason"})
+	metricAuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auc_signer_auth_failures_total",
+		Help: "Signing requests that failed authorization by signer protocol",
+	}, []string{"protocol"})
+	metricRejectedPeerStreams = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auc_signer_rejected_peer_streams_total",
+		Help: "Signing streams reset because the remote peer isn't allowed",
+	})
+	metricStreams = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auc_signer_streams_total",
+		Help: "Handled signing streams by connection path (direct or relayed)",
+	}, []string{"path"})
+	metricSigningDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auc_signer_signing_duration_seconds",
+		Help:    "Time spent by the wallet signing payloads by key type",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"key_type"})
+)
+
+// errorReasons are the known causes of failed signing requests, used as a low-cardinality
+// label instead of the error message.
+var errorReasons = []struct {
+	err    error
+	reason string
+}{
+	{errInvalidAuthToken, "invalid_auth_token"},
+	{errReplayedRequest, "replayed_request"},
+	{errClientMismatch, "client_mismatch"},
+	{errWalletMissingKeys, "wallet_missing_keys"},
+	{errPolicyRejected, "policy_rejected"},
+	{errBudgetExceeded, "budget_exceeded"},
+	{errNotApproved, "not_approved"},
+	{errUnsupportedProtocol, "unsupported_protocol"},
+	{errMalformedPayload, "malformed_payload"},
+}
+
+func recordRequest(protocol, dealProtocol string, err error) {
+	// The deal protocol is sent by the requester, so unknown values are grouped.
+	if scopeOf(dealProtocol) == "" {
+		dealProtocol = "unknown"
+	}
+	if err == nil {
+		metricRequests.WithLabelValues(protocol, dealProtocol, outcomeSigned, "").Inc()
+		return
+	}
+	reason := "other"
+	for _, r := range errorReasons {
+		if errors.Is(err, r.err) {
+			reason = r.reason
+			break
+		}
+	}
+	if reason == "invalid_auth_token" {
+		metricAuthFailures.WithLabelValues(protocol).Inc()
+	}
+	metricRequests.WithLabelValues(protocol, dealProtocol, outcomeFailed, reason).Inc()
+}
+
+func recordStream(path ConnectionPath) {
+	metricStreams.WithLabelValues(string(path)).Inc()
+}
+
+func recordSigningDuration(walletAddr string, d time.Duration) {
+	keyType := "unknown"
+	if addr, err := address.NewFromString(walletAddr); err == nil {
+		switch addr.Protocol() {
+		case address.BLS:
+			keyType = "bls"
+		case address.SECP256K1:
+			keyType = "secp256k1"
+		}
+	}
+	metricSigningDuration.WithLabelValues(keyType).Observe(d.Seconds())
+}
@@ -0,0 +1,209 @@
+package propsigner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Authorizer authorizes signing requests by their auth token.
+type Authorizer interface {
+	// Authorize returns the name of the auth token if it's allowed to request
+	// signatures for walletAddr with the provided scope, or an error otherwise.
+	Authorize(token, walletAddr, scope string) (string, error)
+	// AuthorizeChallenge is like Authorize, for requests that don't include the auth token
+	// but prove knowing it. verify reports if the request was authenticated with a token.
+	AuthorizeChallenge(verify func(token string) bool, walletAddr, scope string) (string, error)
+}
+
+// NonceStore remembers the nonces of signing requests to detect replays.
+type NonceStore interface {
+	// Use marks the nonce as used until expiresAt, returning an error if it
+	// was already used.
+	Use(nonce string, expiresAt time.Time) error
+}
+
+// DealProposalPolicy decides if a deal proposal is allowed to be signed.
+type DealProposalPolicy interface {
+	// Check returns an error explaining why the proposal must not be signed,
+	// or nil if it's allowed. labelBytes is non-nil if the proposal label is
+	// raw bytes instead of a string, in which case proposal.Label is empty.
+	Check(proposal market.DealProposal, labelBytes []byte) error
+}
+
+// SpendingBudget limits the total cost of the deal proposals signed for a wallet address.
+type SpendingBudget interface {
+	// Reserve reserves the cost of the proposal, or returns an error explaining why the
+	// budget doesn't allow it. The returned function must be called with true if the
+	// proposal was signed, or false to release the reservation.
+	Reserve(proposal market.DealProposal) (func(signed bool), error)
+}
+
+// ApprovalQueue holds deal proposals until an operator approves them.
+type ApprovalQueue interface {
+	// AwaitApproval blocks until the proposal is approved, or returns an error if it's
+	// rejected or ctx is done. Proposals that don't require approval return immediately.
+	AwaitApproval(ctx context.Context, proposal market.DealProposal) error
+}
+
+// SigningEvent describes a handled signing request and its outcome.
+type SigningEvent struct {
+	Time                 time.Time
+	RemotePeer           peer.ID
+	TokenName            string
+	WalletAddress        string
+	FilecoinDealProtocol string
+	// Proposal is the decoded deal proposal, if the request was for a deal proposal.
+	// Newer proposal versions are converted, leaving Label empty for bytes labels.
+	Proposal *market.DealProposal
+	// LabelBytes is the proposal label if it's raw bytes instead of a string.
+	LabelBytes []byte
+	// DealStatusRequest is the proposal CID or deal UUID, if the request was for a deal status.
+	DealStatusRequest string
+	// ConnectionPath is whether the request came over a direct or relayed connection.
+	ConnectionPath ConnectionPath
+	// Signature is the produced signature, or nil if the request failed.
+	Signature *crypto.Signature
+	// Err is the reason why the request failed, or nil if it was signed.
+	Err error
+}
+
+// AuditLog records every handled signing request, including streams rejected
+// because the remote peer isn't allowed.
+type AuditLog interface {
+	Record(ev SigningEvent) error
+}
+
+type config struct {
+	ctx          context.Context
+	v1Disabled   bool
+	allowedPeers map[peer.ID]struct{}
+	authorizer   Authorizer
+	nonceStore   NonceStore
+	maxClockSkew time.Duration
+	policies     []DealProposalPolicy
+	budget       SpendingBudget
+	approvals    ApprovalQueue
+	auditLog     AuditLog
+}
+
+// Option configures the deal signer service.
+type Option func(*config) error
+
+// WithContext configures a context for the lifetime of the service. Cancelling it aborts
+// the signing requests being handled, such as the ones waiting for approval, so it should
+// be cancelled when shutting down.
+func WithContext(ctx context.Context) Option {
+	return func(c *config) error {
+		if ctx == nil {
+			return fmt.Errorf("context is nil")
+		}
+		c.ctx = ctx
+		return nil
+	}
+}
+
+// WithV1ProtocolDisabled stops serving the /auctions/fil-signer/1.0.0 protocol, where
+// the auth token is sent in each request. Only clients supporting the challenge-response
+// authentication of /auctions/fil-signer/2.0.0 will be able to request signatures.
+func WithV1ProtocolDisabled() Option {
+	return func(c *config) error {
+		c.v1Disabled = true
+		return nil
+	}
+}
+
+// WithAllowedPeers restricts the peers that can open signing streams. Streams
+// from other peers are reset before reading the request.
+func WithAllowedPeers(peers ...peer.ID) Option {
+	return func(c *config) error {
+		if len(peers) == 0 {
+			return fmt.Errorf("allowed peers list is empty")
+		}
+		if c.allowedPeers == nil {
+			c.allowedPeers = make(map[peer.ID]struct{}, len(peers))
+		}
+		for _, p := range peers {
+			c.allowedPeers[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithAuthorizer configures how signing requests are authorized, instead of
+// the single auth token of NewDealSignerService.
+func WithAuthorizer(a Authorizer) Option {
+	return func(c *config) error {
+		if a == nil {
+			return fmt.Errorf("authorizer is nil")
+		}
+		c.authorizer = a
+		return nil
+	}
+}
+
+// WithReplayProtection rejects signing requests whose timestamp differs from the
+// local clock more than maxClockSkew, or whose nonce was already used.
+func WithReplayProtection(store NonceStore, maxClockSkew time.Duration) Option {
+	return func(c *config) error {
+		if store == nil {
+			return fmt.Errorf("nonce store is nil")
+		}
+		if maxClockSkew <= 0 {
+			return fmt.Errorf("max clock skew must be positive")
+		}
+		c.nonceStore = store
+		c.maxClockSkew = maxClockSkew
+		return nil
+	}
+}
+
+// WithDealProposalPolicy adds a policy that deal proposals must satisfy before being signed.
+// Multiple policies can be provided, and all of them are evaluated in order.
+func WithDealProposalPolicy(p DealProposalPolicy) Option {
+	return func(c *config) error {
+		if p == nil {
+			return fmt.Errorf("deal proposal policy is nil")
+		}
+		c.policies = append(c.policies, p)
+		return nil
+	}
+}
+
+// WithSpendingBudget configures a budget that limits the cost of signed deal proposals.
+func WithSpendingBudget(b SpendingBudget) Option {
+	return func(c *config) error {
+		if b == nil {
+			return fmt.Errorf("spending budget is nil")
+		}
+		c.budget = b
+		return nil
+	}
+}
+
+// WithApprovalQueue configures a queue where deal proposals can be held for manual approval
+// before being signed. The requester waits for the decision while the stream is open.
+func WithApprovalQueue(q ApprovalQueue) Option {
+	return func(c *config) error {
+		if q == nil {
+			return fmt.Errorf("approval queue is nil")
+		}
+		c.approvals = q
+		return nil
+	}
+}
+
+// WithAuditLog configures an audit log where every handled signing request is recorded.
+func WithAuditLog(l AuditLog) Option {
+	return func(c *config) error {
+		if l == nil {
+			return fmt.Errorf("audit log is nil")
+		}
+		c.auditLog = l
+		return nil
+	}
+}
@@ -0,0 +1,68 @@
+package propsigner
+
+import (
+	"bytes"
+	"fmt"
+
+	marketv8 "github.com/filecoin-project/go-state-types/builtin/v8/market"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+)
+
+// decodeDealProposal decodes a deal proposal payload of the filecoinDealProtocol version.
+// Proposals of newer versions are converted to the original market.DealProposal, so they're
+// validated, budgeted and audited the same way. Bytes labels aren't valid strings, so they're
+// returned apart with an empty Label; the returned label bytes are nil for string labels.
+func decodeDealProposal(filecoinDealProtocol string, payload []byte) (market.DealProposal, []byte, error) {
+	switch filecoinDealProtocol {
+	case filDealProposalProtocolV1:
+		var proposal market.DealProposal
+		if err := proposal.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+			return market.DealProposal{}, nil, err
+		}
+		return proposal, nil, nil
+	case filDealProposalProtocolV2:
+		var proposal marketv8.DealProposal
+		if err := proposal.UnmarshalCBOR(bytes.NewReader(payload)); err != nil {
+			return market.DealProposal{}, nil, err
+		}
+		if proposal.Label.Length() > marketv8.DealMaxLabelSize {
+			return market.DealProposal{}, nil, fmt.Errorf(
+				"label is too long (%d), max allowed (%d)", proposal.Label.Length(), marketv8.DealMaxLabelSize)
+		}
+		label, labelBytes, err := splitDealLabel(proposal.Label)
+		if err != nil {
+			return market.DealProposal{}, nil, fmt.Errorf("reading label: %s", err)
+		}
+		return market.DealProposal{
+			PieceCID:             proposal.PieceCID,
+			PieceSize:            proposal.PieceSize,
+			VerifiedDeal:         proposal.VerifiedDeal,
+			Client:               proposal.Client,
+			Provider:             proposal.Provider,
+			Label:                label,
+			StartEpoch:           proposal.StartEpoch,
+			EndEpoch:             proposal.EndEpoch,
+			StoragePricePerEpoch: proposal.StoragePricePerEpoch,
+			ProviderCollateral:   proposal.ProviderCollateral,
+			ClientCollateral:     proposal.ClientCollateral,
+		}, labelBytes, nil
+	default:
+		return market.DealProposal{}, nil, fmt.Errorf("unsupported deal proposal protocol %s", filecoinDealProtocol)
+	}
+}
+
+// splitDealLabel returns the label if it's a string, or its bytes otherwise.
+func splitDealLabel(label marketv8.DealLabel) (string, []byte, error) {
+	if label.IsString() {
+		s, err := label.ToString()
+		return s, nil, err
+	}
+	bs, err := label.ToBytes()
+	if err != nil {
+		return "", nil, err
+	}
+	if bs == nil {
+		bs = []byte{}
+	}
+	return "", bs, nil
+}
@@ -1,11 +1,18 @@
 package propsigner
 
 import (
-	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"errors"
 	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 
+	"github.com/filecoin-project/go-address"
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
@@ -13,12 +20,19 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
 	pb "github.com/textileio/go-auctions-client/gen/wallet"
 	logger "github.com/textileio/go-log/v2"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	v1Protocol = "/auctions/fil-signer/1.0.0"
+	// v2Protocol doesn't send the auth token in requests. The remote wallet sends a challenge,
+	// and the client proves knowing the auth token with an HMAC of the challenge and the request.
+	v2Protocol = "/auctions/fil-signer/2.0.0"
+
+	challengeSize = 32
 
 	maxRequestMessageSize = 100 << 10 // 100KiB
 
@@ -26,139 +40,459 @@ const (
 	// This value is used to know how to unmarshal proposal payloads. Future deal proposal versions
 	// might be supported, and thus we need to be able to distinguish them to do proper unmarshaling.
 	filDealProposalProtocolV1 = "/fil/storage/mk/1.1.0"
+	// filDealProposalProtocolV2 sends deal proposals whose label is a string or bytes union,
+	// as in the builtin v8 market actor and Boost.
+	filDealProposalProtocolV2 = "/fil/storage/mk/1.2.0"
 	// filDealStatusProtocol is the libp2p protocol used to send deal status requests in Filecoin.
 	filDealStatusProtocol = "/fil/storage/status/1.1.0"
+
+	// ScopeDealProposal is the authorization scope of deal proposal signing requests.
+	ScopeDealProposal = "proposal"
+	// ScopeDealStatus is the authorization scope of deal status signing requests.
+	ScopeDealStatus = "status"
+
+	// defaultTokenName is the name of the single auth token provided to NewDealSignerService.
+	defaultTokenName = "default"
 )
 
 var (
 	log            = logger.Logger("propsigner")
 	streamDeadline = time.Minute
+	// replyMargin is the time left before the stream deadline to reply after waiting for approval.
+	replyMargin = 5 * time.Second
 
-	errInvalidAuthToken  = errors.New("invalid auth token")
-	errWalletMissingKeys = errors.New("wallet doesn't have keys for address")
-)
+	errInvalidAuthToken    = errors.New("invalid auth token")
+	errWalletMissingKeys   = errors.New("wallet doesn't have keys for address")
+	errClientMismatch      = errors.New("proposal client doesn't match the wallet address")
+	errReplayedRequest     = errors.New("request is stale or replayed")
+	errPolicyRejected      = errors.New("rejected by policy")
+	errBudgetExceeded      = errors.New("spending budget exceeded")
+	errNotApproved         = errors.New("awaiting approval")
+	errUnsupportedProtocol = errors.New("unsupported filecoin deal protocol")
+	errMalformedPayload    = errors.New("malformed payload")
+	errPeerNotAllowed      = errors.New("peer not allowed")
 
-// Wallet contains private keys for Filecoin addresses.
-type Wallet interface {
-	Has(addr string) (bool, error)
-	Sign(addr string, payload []byte) (*crypto.Signature, error)
-}
+	// errorCodes classify the errors replied to clients. Other errors are internal.
+	errorCodes = []struct {
+		err  error
+		code pb.ErrorCode
+	}{
+		{errInvalidAuthToken, pb.ErrorCode_ERROR_CODE_INVALID_TOKEN},
+		{errReplayedRequest, pb.ErrorCode_ERROR_CODE_REPLAYED_REQUEST},
+		{errWalletMissingKeys, pb.ErrorCode_ERROR_CODE_UNKNOWN_ADDRESS},
+		{errClientMismatch, pb.ErrorCode_ERROR_CODE_MALFORMED_PAYLOAD},
+		{errMalformedPayload, pb.ErrorCode_ERROR_CODE_MALFORMED_PAYLOAD},
+		{errUnsupportedProtocol, pb.ErrorCode_ERROR_CODE_UNSUPPORTED_PROTOCOL},
+		{errPolicyRejected, pb.ErrorCode_ERROR_CODE_POLICY_REJECTED},
+		{errBudgetExceeded, pb.ErrorCode_ERROR_CODE_POLICY_REJECTED},
+		{errNotApproved, pb.ErrorCode_ERROR_CODE_POLICY_REJECTED},
+	}
+)
 
 type dealSignerService struct {
-	authToken string
-	wallet    Wallet
+	// rejectedPeerStreams is the first field to guarantee 64-bit alignment for atomic operations.
+	rejectedPeerStreams uint64
+
+	// ctx is the parent of the signing requests contexts, cancelled when shutting down.
+	ctx          context.Context
+	allowedPeers map[peer.ID]struct{}
+	authorizer   Authorizer
+	nonceStore   NonceStore
+	maxClockSkew time.Duration
+	wallet       WalletV2
+	policies     []DealProposalPolicy
+	budget       SpendingBudget
+	approvals    ApprovalQueue
+	auditLog     AuditLog
 }
 
 // NewDealSignerService configures a stream handler for the proposal signer protocol.
-func NewDealSignerService(h host.Host, authToken string, wallet Wallet) error {
-	if authToken == "" {
-		return fmt.Errorf("authorization token is empty")
+// Requests are authorized with authToken, unless an authorizer is configured with
+// WithAuthorizer; in that case authToken must be empty.
+func NewDealSignerService(h host.Host, authToken string, wallet Wallet, opts ...Option) error {
+	return NewDealSignerServiceV2(h, authToken, AdaptWallet(wallet), opts...)
+}
+
+// NewDealSignerServiceV2 is like NewDealSignerService, for wallets implementing WalletV2.
+func NewDealSignerServiceV2(h host.Host, authToken string, wallet WalletV2, opts ...Option) error {
+	var cfg config
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return fmt.Errorf("applying option: %s", err)
+		}
+	}
+	authorizer := cfg.authorizer
+	if authorizer == nil {
+		if authToken == "" {
+			return fmt.Errorf("authorization token is empty")
+		}
+		authorizer = staticAuthorizer(authToken)
+	} else if authToken != "" {
+		return fmt.Errorf("authorization token and authorizer can't be both provided")
+	}
+	ctx := cfg.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	dss := &dealSignerService{
+		ctx:          ctx,
+		allowedPeers: cfg.allowedPeers,
+		authorizer:   authorizer,
+		nonceStore:   cfg.nonceStore,
+		maxClockSkew: cfg.maxClockSkew,
+		wallet:       wallet,
+		policies:     cfg.policies,
+		budget:       cfg.budget,
+		approvals:    cfg.approvals,
+		auditLog:     cfg.auditLog,
 	}
-	dss := dealSignerService{
-		authToken: authToken,
-		wallet:    wallet,
+	if !cfg.v1Disabled {
+		h.SetStreamHandler(v1Protocol, dss.streamHandlerV1)
 	}
-	h.SetStreamHandler(v1Protocol, dss.streamHandler)
+	h.SetStreamHandler(v2Protocol, dss.streamHandlerV2)
 
 	return nil
 }
 
-func (dss *dealSignerService) streamHandler(s network.Stream) {
-	log.Infof("handling signing request...")
+// cancelOnStreamError calls cancel if the stream is reset or its connection is closed
+// while the request is being handled. The requester doesn't send anything after the
+// request, so reads only return when the stream fails or is closed.
+func cancelOnStreamError(s network.Stream, cancel context.CancelFunc) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := s.Read(buf); err != nil {
+			if !errors.Is(err, io.EOF) {
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+// requestReader reads an authorized signing request from a stream, filling ev with its details.
+type requestReader func(s network.Stream, ev *SigningEvent) (*pb.SigningRequest, error)
+
+func (dss *dealSignerService) streamHandlerV1(s network.Stream) {
+	dss.streamHandler(s, dss.readRequestV1)
+}
+
+func (dss *dealSignerService) streamHandlerV2(s network.Stream) {
+	dss.streamHandler(s, dss.readRequestV2)
+}
+
+func (dss *dealSignerService) streamHandler(s network.Stream, readRequest requestReader) {
+	remotePeer := s.Conn().RemotePeer()
+	if _, ok := dss.allowedPeers[remotePeer]; dss.allowedPeers != nil && !ok {
+		rejected := atomic.AddUint64(&dss.rejectedPeerStreams, 1)
+		metricRejectedPeerStreams.Inc()
+		log.Warnf("rejected signing stream from not allowed peer %s (total rejected: %d)", remotePeer, rejected)
+		if err := s.Reset(); err != nil {
+			log.Errorf("resetting stream: %s", err)
+		}
+		dss.recordAudit(SigningEvent{
+			Time:           time.Now(),
+			RemotePeer:     remotePeer,
+			ConnectionPath: connectionPath(s.Conn()),
+			Err:            errPeerNotAllowed,
+		})
+		return
+	}
+
+	path := connectionPath(s.Conn())
+	recordStream(path)
+	log.Infof("handling signing request from %s over %s connection...", remotePeer, path)
 	defer func() {
 		if err := s.Close(); err != nil {
 			log.Errorf("closing deal proposal signer stream: %s", err)
 		}
 	}()
-	if err := s.SetDeadline(time.Now().Add(streamDeadline)); err != nil {
+	deadline := time.Now().Add(streamDeadline)
+	if err := s.SetDeadline(deadline); err != nil {
 		log.Errorf("set deadline in stream: %s", err)
 	}
+	ctx, cancel := context.WithDeadline(dss.ctx, deadline.Add(-replyMargin))
+	defer cancel()
 
-	var req pb.SigningRequest
-	if err := readMsg(s, maxRequestMessageSize, &req); err != nil {
-		replyWithError(s, "unmarshaling proposal signing request: %s", err)
+	ev := SigningEvent{
+		Time:           time.Now(),
+		RemotePeer:     remotePeer,
+		ConnectionPath: path,
+	}
+	sig, err := dss.signRequest(ctx, s, &ev, readRequest)
+	ev.Signature, ev.Err = sig, err
+	recordRequest(string(s.Protocol()), ev.FilecoinDealProtocol, err)
+	dss.recordAudit(ev)
+	if err != nil {
+		replyWithError(s, errorCode(err), "%s", err)
+		return
+	}
+
+	sigBytes, err := sig.MarshalBinary()
+	if err != nil {
+		replyWithError(s, pb.ErrorCode_ERROR_CODE_INTERNAL, "marshaling signature: %s", err)
+		return
+	}
+	res := pb.SigningResponse{
+		Signature: sigBytes,
+	}
+	if err := writeMsg(s, &res); err != nil {
+		log.Errorf("writing error response to stream: %s", err)
 		return
 	}
-	if req.AuthToken != dss.authToken {
-		replyWithError(s, errInvalidAuthToken.Error())
+	log.Infof("request signed successfully")
+}
+
+// recordAudit records the signing request in the audit log, if configured.
+func (dss *dealSignerService) recordAudit(ev SigningEvent) {
+	if dss.auditLog == nil {
 		return
 	}
+	if err := dss.auditLog.Record(ev); err != nil {
+		log.Errorf("recording signing request in audit log: %s", err)
+	}
+}
+
+// signRequest reads a signing request from the stream, and returns its signature if
+// the request is valid. ev is filled with the details of the request as they're known.
+func (dss *dealSignerService) signRequest(
+	ctx context.Context,
+	s network.Stream,
+	ev *SigningEvent,
+	readRequest requestReader) (*crypto.Signature, error) {
+	req, err := readRequest(s, ev)
+	if err != nil {
+		return nil, err
+	}
+	// The signature can't be delivered if the stream fails, so there's no point in
+	// waiting for approval or the wallet.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go cancelOnStreamError(s, cancel)
+	log.Infof("signing request authorized with token %s", ev.TokenName)
+	if dss.nonceStore != nil {
+		if err := dss.checkFreshness(req); err != nil {
+			return nil, fmt.Errorf("%w: %s", errReplayedRequest, err)
+		}
+	}
 
 	var payloadToBeSigned []byte
+	var settleSpending func(signed bool)
 	switch req.FilecoinDealProtocol {
-	case filDealProposalProtocolV1:
-		var proposal market.DealProposal
-		if err := proposal.UnmarshalCBOR(bytes.NewReader(req.Payload)); err != nil {
-			replyWithError(s, "unmarshaling proposal payload: %s", err)
-			return
+	case filDealProposalProtocolV1, filDealProposalProtocolV2:
+		proposal, labelBytes, err := decodeDealProposal(req.FilecoinDealProtocol, req.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unmarshaling proposal payload: %s", errMalformedPayload, err)
 		}
-		if err := dss.validateDealProposalV1(proposal); err != nil {
-			replyWithError(s, "validating deal proposal: %s", err)
-			return
+		ev.Proposal, ev.LabelBytes = &proposal, labelBytes
+		if err := dss.validateDealProposalV1(ctx, req.WalletAddress, proposal, labelBytes); err != nil {
+			return nil, fmt.Errorf("validating deal proposal: %w", err)
+		}
+		if dss.budget != nil {
+			settle, err := dss.budget.Reserve(proposal)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", errBudgetExceeded, err)
+			}
+			settleSpending = settle
+		}
+		if dss.approvals != nil {
+			if err := dss.approvals.AwaitApproval(ctx, proposal); err != nil {
+				if settleSpending != nil {
+					settleSpending(false)
+				}
+				return nil, fmt.Errorf("%w: %s", errNotApproved, err)
+			}
 		}
 		log.Infof("signing deal proposal for storage-provider %s", proposal.Provider)
 		payloadToBeSigned = req.Payload
 	case filDealStatusProtocol:
-		if _, err := uuid.FromBytes(req.Payload); err == nil {
+		if id, err := uuid.FromBytes(req.Payload); err == nil {
+			ev.DealStatusRequest = id.String()
 			payloadToBeSigned = req.Payload
 			break
 		}
 
 		var proposalCid cid.Cid
 		if err := proposalCid.UnmarshalBinary(req.Payload); err != nil {
-			replyWithError(s, "unmarshaling proposal cid: %s", err)
+			return nil, fmt.Errorf("%w: unmarshaling proposal cid: %s", errMalformedPayload, err)
 		}
+		ev.DealStatusRequest = proposalCid.String()
 
 		log.Infof("signing deal status request for proposal %s", proposalCid)
 		propCidCbor, err := cborutil.Dump(proposalCid)
 		if err != nil {
-			replyWithError(s, "marshaling proposal cid to cbor: %s", err)
-			return
+			return nil, fmt.Errorf("marshaling proposal cid to cbor: %s", err)
 		}
 		payloadToBeSigned = propCidCbor
 	default:
-		replyWithError(s, "unsupported filecoin deal proposal protocol")
-		return
+		return nil, fmt.Errorf("%w %q", errUnsupportedProtocol, req.FilecoinDealProtocol)
 	}
 
-	sig, err := dss.wallet.Sign(req.WalletAddress, payloadToBeSigned)
+	start := time.Now()
+	info := SigningRequestInfo{
+		RemotePeer:           ev.RemotePeer,
+		TokenName:            ev.TokenName,
+		FilecoinDealProtocol: ev.FilecoinDealProtocol,
+		Proposal:             ev.Proposal,
+		LabelBytes:           ev.LabelBytes,
+		DealStatusRequest:    ev.DealStatusRequest,
+	}
+	sig, err := dss.wallet.Sign(ctx, req.WalletAddress, payloadToBeSigned, info)
+	recordSigningDuration(req.WalletAddress, time.Since(start))
+	if settleSpending != nil {
+		settleSpending(err == nil)
+	}
 	if err != nil {
-		replyWithError(s, "signing proposal: %s", err)
-		return
+		return nil, fmt.Errorf("signing proposal: %s", err)
 	}
-	sigBytes, err := sig.MarshalBinary()
+	return sig, nil
+}
+
+func (dss *dealSignerService) readRequestV1(s network.Stream, ev *SigningEvent) (*pb.SigningRequest, error) {
+	var req pb.SigningRequest
+	if err := readMsg(s, maxRequestMessageSize, &req); err != nil {
+		return nil, fmt.Errorf("%w: unmarshaling proposal signing request: %s", errMalformedPayload, err)
+	}
+	ev.WalletAddress = req.WalletAddress
+	ev.FilecoinDealProtocol = req.FilecoinDealProtocol
+	tokenName, err := dss.authorizer.Authorize(req.AuthToken, req.WalletAddress, scopeOf(req.FilecoinDealProtocol))
 	if err != nil {
-		replyWithError(s, "marshaling signature: %s", err)
-		return
+		return nil, fmt.Errorf("%w: %s", errInvalidAuthToken, err)
 	}
-	res := pb.SigningResponse{
-		Signature: sigBytes,
+	ev.TokenName = tokenName
+
+	return &req, nil
+}
+
+func (dss *dealSignerService) readRequestV2(s network.Stream, ev *SigningEvent) (*pb.SigningRequest, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("generating challenge: %s", err)
 	}
-	if err := writeMsg(s, &res); err != nil {
-		log.Errorf("writing error response to stream: %s", err)
-		return
+	if err := writeMsg(s, &pb.AuthChallenge{Challenge: challenge}); err != nil {
+		return nil, fmt.Errorf("sending challenge: %s", err)
 	}
-	log.Infof("request signed successfully")
+
+	var authReq pb.AuthenticatedSigningRequest
+	if err := readMsg(s, maxRequestMessageSize, &authReq); err != nil {
+		return nil, fmt.Errorf("%w: unmarshaling authenticated signing request: %s", errMalformedPayload, err)
+	}
+	var req pb.SigningRequest
+	if err := proto.Unmarshal(authReq.Request, &req); err != nil {
+		return nil, fmt.Errorf("%w: unmarshaling proposal signing request: %s", errMalformedPayload, err)
+	}
+	ev.WalletAddress = req.WalletAddress
+	ev.FilecoinDealProtocol = req.FilecoinDealProtocol
+	if req.AuthToken != "" {
+		return nil, fmt.Errorf("%w: auth token must not be sent in the request", errInvalidAuthToken)
+	}
+	verify := func(token string) bool {
+		return hmac.Equal(authReq.Hmac, requestHMAC(token, challenge, authReq.Request))
+	}
+	tokenName, err := dss.authorizer.AuthorizeChallenge(verify, req.WalletAddress, scopeOf(req.FilecoinDealProtocol))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidAuthToken, err)
+	}
+	ev.TokenName = tokenName
+
+	return &req, nil
 }
 
-func (dss *dealSignerService) validateDealProposalV1(proposal market.DealProposal) error {
-	ok, err := dss.wallet.Has(proposal.Client.String())
+func (dss *dealSignerService) checkFreshness(req *pb.SigningRequest) error {
+	if req.Timestamp == 0 || req.Nonce == "" {
+		return fmt.Errorf("timestamp and nonce are required")
+	}
+	ts := time.Unix(req.Timestamp, 0)
+	if skew := time.Since(ts); skew > dss.maxClockSkew || skew < -dss.maxClockSkew {
+		return fmt.Errorf("timestamp %s is outside the allowed clock skew of %s", ts, dss.maxClockSkew)
+	}
+	if err := dss.nonceStore.Use(req.Nonce, ts.Add(dss.maxClockSkew)); err != nil {
+		return fmt.Errorf("using nonce: %s", err)
+	}
+	return nil
+}
+
+func (dss *dealSignerService) validateDealProposalV1(
+	ctx context.Context,
+	walletAddr string,
+	proposal market.DealProposal,
+	labelBytes []byte) error {
+	// Compare parsed addresses, so mainnet and testnet prefixes of the same address match.
+	addr, err := address.NewFromString(walletAddr)
+	if err != nil {
+		return fmt.Errorf("parsing wallet address: %s", err)
+	}
+	if proposal.Client != addr {
+		return errClientMismatch
+	}
+	ok, err := dss.wallet.Has(ctx, proposal.Client.String())
 	if err != nil {
 		return fmt.Errorf("checking wallet keys: %s", err)
 	}
 	if !ok {
 		return errWalletMissingKeys
 	}
+	for _, p := range dss.policies {
+		if err := p.Check(proposal, labelBytes); err != nil {
+			return fmt.Errorf("%w: %s", errPolicyRejected, err)
+		}
+	}
 
 	return nil
 }
 
-func replyWithError(s network.Stream, format string, params ...interface{}) {
+func scopeOf(filecoinDealProtocol string) string {
+	switch filecoinDealProtocol {
+	case filDealProposalProtocolV1, filDealProposalProtocolV2:
+		return ScopeDealProposal
+	case filDealStatusProtocol:
+		return ScopeDealStatus
+	default:
+		return ""
+	}
+}
+
+// staticAuthorizer authorizes requests with a single auth token.
+type staticAuthorizer string
+
+func (a staticAuthorizer) Authorize(token, _, _ string) (string, error) {
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a)) != 1 {
+		return "", errors.New("token doesn't match")
+	}
+	return defaultTokenName, nil
+}
+
+func (a staticAuthorizer) AuthorizeChallenge(verify func(token string) bool, _, _ string) (string, error) {
+	if !verify(string(a)) {
+		return "", errors.New("token doesn't match")
+	}
+	return defaultTokenName, nil
+}
+
+// requestHMAC returns the proof of knowing the auth token for a v2 signing request.
+func requestHMAC(token string, challenge, request []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(token))
+	_, _ = mac.Write(challenge)
+	_, _ = mac.Write(request)
+	return mac.Sum(nil)
+}
+
+// errorCode returns the code of err replied to clients.
+func errorCode(err error) pb.ErrorCode {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return pb.ErrorCode_ERROR_CODE_INTERNAL
+}
+
+func replyWithError(s network.Stream, code pb.ErrorCode, format string, params ...interface{}) {
 	str := fmt.Sprintf(format, params...)
 	log.Errorf(str)
 
 	res := &pb.SigningResponse{
-		Error: str,
+		Error:     str,
+		ErrorCode: code,
 	}
 	if err := writeMsg(s, res); err != nil {
 		log.Errorf("writing error response to stream: %s", err)
@@ -1,20 +1,43 @@
 package propsigner
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	"github.com/filecoin-project/go-state-types/big"
+	marketv8 "github.com/filecoin-project/go-state-types/builtin/v8/market"
+	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/specs-actors/actors/builtin/market"
 	"github.com/ipfs/go-cid"
 	libwal "github.com/jsign/go-filsigner/wallet"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	swarmt "github.com/libp2p/go-libp2p-swarm/testing"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+	"github.com/textileio/go-auctions-client/approval"
+	"github.com/textileio/go-auctions-client/auth"
+	pb "github.com/textileio/go-auctions-client/gen/wallet"
 	"github.com/textileio/go-auctions-client/localwallet"
+	"github.com/textileio/go-auctions-client/replay"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -99,6 +122,42 @@ func TestDealProposalSigning(t *testing.T) {
 	}
 }
 
+func TestDealProposalSigningV2(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	lw, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	wallet := &recordingWallet{WalletV2: AdaptWallet(lw)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newConnectedHosts(t)
+	require.NoError(t, NewDealSignerServiceV2(h1, authToken, wallet))
+
+	stringLabel, err := marketv8.NewLabelFromString("this is a fake label")
+	require.NoError(t, err)
+	bytesLabel, err := marketv8.NewLabelFromBytes([]byte{0xff, 0x00, 0x01})
+	require.NoError(t, err)
+	for _, proposal := range []market.DealProposal{correctProposalSecp256k1(t), correctProposalBLS(t)} {
+		for _, label := range []marketv8.DealLabel{stringLabel, bytesLabel} {
+			proposalV2 := toDealProposalV2(proposal, label)
+			sig, err := RequestDealProposalSignatureV2(ctx, h2, authToken, proposalV2, h1.ID())
+			require.NoError(t, err)
+			require.NoError(t, ValidateDealProposalSignatureV2(proposalV2, sig))
+			require.Equal(t, filDealProposalProtocolV2, wallet.info.FilecoinDealProtocol)
+			if label.IsString() {
+				require.Equal(t, label.Length(), len(wallet.info.Proposal.Label))
+				require.Nil(t, wallet.info.LabelBytes)
+			} else {
+				require.Empty(t, wallet.info.Proposal.Label)
+				require.Equal(t, label.Length(), len(wallet.info.LabelBytes))
+			}
+		}
+	}
+}
+
 func TestDealStatusSigning(t *testing.T) {
 	t.Parallel()
 
@@ -135,6 +194,747 @@ func TestDealStatusSigning(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestDealProposalPolicy(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	maxPrice := policyFunc(func(proposal market.DealProposal) error {
+		if proposal.StoragePricePerEpoch.GreaterThan(big.NewInt(1000)) {
+			return errors.New("price is too high")
+		}
+		return nil
+	})
+	h1, h2 := newSignerHosts(t, authToken, wallet, WithDealProposalPolicy(maxPrice))
+
+	proposal := correctProposalSecp256k1(t)
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errPolicyRejected.Error())
+	require.Contains(t, err.Error(), "price is too high")
+
+	proposal.StoragePricePerEpoch = big.NewInt(1000)
+	sig, err := RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+	require.NoError(t, ValidateDealProposalSignature(proposal, sig))
+}
+
+func TestApprovalQueue(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	proposal := correctProposalSecp256k1(t)
+	queue, err := approval.New(map[string]approval.Config{proposal.Client.String(): {Threshold: "0"}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newSignerHosts(t, authToken, wallet, WithApprovalQueue(queue))
+
+	// Operator decisions.
+	decisions := make(chan error, 2)
+	go func() {
+		for _, approve := range []bool{false, true} {
+			for len(queue.Pending()) == 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			decisions <- queue.Decide(queue.Pending()[0].ID, approve)
+		}
+	}()
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rejected by operator")
+	require.NoError(t, <-decisions)
+
+	sig, err := RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+	require.NoError(t, ValidateDealProposalSignature(proposal, sig))
+	require.NoError(t, <-decisions)
+}
+
+func TestApprovalCancellation(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	proposal := correctProposalSecp256k1(t)
+	queue, err := approval.New(map[string]approval.Config{proposal.Client.String(): {Threshold: "0"}})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serviceCtx, cancelService := context.WithCancel(context.Background())
+	defer cancelService()
+	events := make(chan SigningEvent, 2)
+	recordEvent := auditFunc(func(ev SigningEvent) error {
+		events <- ev
+		return nil
+	})
+	h1, h2 := newSignerHosts(t, authToken, wallet,
+		WithContext(serviceCtx), WithApprovalQueue(queue), WithAuditLog(recordEvent))
+
+	waitPending := func() {
+		require.Eventually(t, func() bool { return len(queue.Pending()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	}
+	// The request must be aborted well before the stream deadline.
+	requireAborted := func() {
+		select {
+		case ev := <-events:
+			require.Error(t, ev.Err)
+			require.Contains(t, ev.Err.Error(), "approval timed out")
+		case <-time.After(5 * time.Second):
+			t.Fatal("signing request wasn't aborted")
+		}
+		require.Empty(t, queue.Pending())
+	}
+
+	// The requester resets the stream while the proposal waits for approval.
+	payload := &bytes.Buffer{}
+	require.NoError(t, proposal.MarshalCBOR(payload))
+	s, err := h2.NewStream(ctx, h1.ID(), v1Protocol)
+	require.NoError(t, err)
+	require.NoError(t, writeMsg(s, &pb.SigningRequest{
+		AuthToken:            authToken,
+		WalletAddress:        proposal.Client.String(),
+		FilecoinDealProtocol: filDealProposalProtocolV1,
+		Payload:              payload.Bytes(),
+	}))
+	waitPending()
+	require.NoError(t, s.Reset())
+	requireAborted()
+
+	// The service shuts down while the proposal waits for approval.
+	results := make(chan error, 1)
+	go func() {
+		_, err := RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+		results <- err
+	}()
+	waitPending()
+	cancelService()
+	require.Error(t, <-results)
+	requireAborted()
+}
+
+// TestMetrics isn't parallel, so other tests don't change the counters while it runs.
+func TestMetrics(t *testing.T) {
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newSignerHosts(t, authToken, wallet)
+
+	proposalRequests := metricRequests.MustCurryWith(prometheus.Labels{
+		"protocol":      v2Protocol,
+		"deal_protocol": filDealProposalProtocolV1,
+	})
+	signed := proposalRequests.WithLabelValues(outcomeSigned, "")
+	unauthorized := proposalRequests.WithLabelValues(outcomeFailed, "invalid_auth_token")
+	authFailures := metricAuthFailures.WithLabelValues(v2Protocol)
+	signedBefore, unauthorizedBefore := testutil.ToFloat64(signed), testutil.ToFloat64(unauthorized)
+	authFailuresBefore := testutil.ToFloat64(authFailures)
+
+	proposal := correctProposalSecp256k1(t)
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "wrongtoken", proposal, h1.ID())
+	require.Error(t, err)
+
+	require.Equal(t, signedBefore+1, testutil.ToFloat64(signed))
+	require.Equal(t, unauthorizedBefore+1, testutil.ToFloat64(unauthorized))
+	require.Equal(t, authFailuresBefore+1, testutil.ToFloat64(authFailures))
+	require.Positive(t, testutil.CollectAndCount(metricSigningDuration))
+}
+
+func TestAuthorizer(t *testing.T) {
+	t.Parallel()
+
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	proposal := correctProposalSecp256k1(t)
+	tokens, err := auth.New(map[string]auth.Config{
+		"status-only": {Token: "statustoken", Scopes: []string{ScopeDealStatus}},
+		"proposals":   {Token: "proposaltoken", Addresses: []string{proposal.Client.String()}},
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newSignerHosts(t, "", wallet, WithAuthorizer(tokens))
+	err = NewDealSignerService(h1, "sometoken", wallet, WithAuthorizer(tokens))
+	require.Error(t, err)
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "statustoken", proposal, h1.ID())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errInvalidAuthToken.Error())
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "proposaltoken", correctProposalBLS(t), h1.ID())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errInvalidAuthToken.Error())
+
+	sig, err := RequestDealProposalSignatureV1(ctx, h2, "proposaltoken", proposal, h1.ID())
+	require.NoError(t, err)
+	require.NoError(t, ValidateDealProposalSignature(proposal, sig))
+}
+
+func TestAllowedPeers(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Client (dealerd) libp2p2 hosts.
+	allowed, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	notAllowed, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+
+	// Remote wallet libp2p host.
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	events := make(chan SigningEvent, 2)
+	recordEvent := auditFunc(func(ev SigningEvent) error {
+		events <- ev
+		return nil
+	})
+	err = NewDealSignerService(h1, authToken, wallet, WithAllowedPeers(allowed.ID()), WithAuditLog(recordEvent))
+	require.NoError(t, err)
+
+	proposal := correctProposalSecp256k1(t)
+	for _, h := range []*bhost.BasicHost{allowed, notAllowed} {
+		err = h.Connect(ctx, peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()})
+		require.NoError(t, err)
+	}
+	sig, err := RequestDealProposalSignatureV1(ctx, allowed, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+	require.NoError(t, ValidateDealProposalSignature(proposal, sig))
+
+	require.NoError(t, (<-events).Err)
+
+	_, err = RequestDealProposalSignatureV1(ctx, notAllowed, authToken, proposal, h1.ID())
+	require.Error(t, err)
+	ev := <-events
+	require.Equal(t, notAllowed.ID(), ev.RemotePeer)
+	require.ErrorIs(t, ev.Err, errPeerNotAllowed)
+}
+
+func TestChallengeAuthentication(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The remote wallet host only serves the v2 protocol.
+	h1, h2 := newSignerHosts(t, authToken, wallet, WithV1ProtocolDisabled())
+
+	proposal := correctProposalSecp256k1(t)
+	sig, err := RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+	require.NoError(t, ValidateDealProposalSignature(proposal, sig))
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "wrongtoken", proposal, h1.ID())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errInvalidAuthToken.Error())
+
+	// Old clients sending the auth token can't open a stream.
+	_, err = h2.NewStream(ctx, h1.ID(), v1Protocol)
+	require.Error(t, err)
+
+	// The auth token must not be sent in v2 requests.
+	s, err := h2.NewStream(ctx, h1.ID(), v2Protocol)
+	require.NoError(t, err)
+	defer func() { _ = s.Close() }()
+	var challenge pb.AuthChallenge
+	require.NoError(t, readMsg(s, maxResponseMessageSize, &challenge))
+	reqBytes, err := proto.Marshal(&pb.SigningRequest{AuthToken: authToken, WalletAddress: proposal.Client.String()})
+	require.NoError(t, err)
+	authReq := &pb.AuthenticatedSigningRequest{
+		Request: reqBytes,
+		Hmac:    requestHMAC(authToken, challenge.Challenge, reqBytes),
+	}
+	require.NoError(t, writeMsg(s, authReq))
+	var res pb.SigningResponse
+	require.NoError(t, readMsg(s, maxResponseMessageSize, &res))
+	require.Contains(t, res.Error, errInvalidAuthToken.Error())
+}
+
+func TestReplayProtection(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	nonceStore, err := replay.Open(filepath.Join(t.TempDir(), "nonces"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, nonceStore.Close()) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newSignerHosts(t, authToken, wallet, WithReplayProtection(nonceStore, time.Minute))
+
+	// The client populates the timestamp and nonce automatically.
+	proposal := correctProposalSecp256k1(t)
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+
+	payload := &bytes.Buffer{}
+	require.NoError(t, proposal.MarshalCBOR(payload))
+	req := &pb.SigningRequest{
+		AuthToken:            authToken,
+		WalletAddress:        proposal.Client.String(),
+		FilecoinDealProtocol: filDealProposalProtocolV1,
+		Payload:              payload.Bytes(),
+		Timestamp:            time.Now().Unix(),
+		Nonce:                "fixednonce",
+	}
+	res := sendRawRequest(ctx, t, h2, h1.ID(), req)
+	require.Empty(t, res.Error)
+
+	// Replayed nonce.
+	res = sendRawRequest(ctx, t, h2, h1.ID(), req)
+	require.Contains(t, res.Error, errReplayedRequest.Error())
+	require.Equal(t, pb.ErrorCode_ERROR_CODE_REPLAYED_REQUEST, res.ErrorCode)
+
+	// Stale timestamp.
+	req.Nonce = "othernonce"
+	req.Timestamp = time.Now().Add(-time.Hour).Unix()
+	res = sendRawRequest(ctx, t, h2, h1.ID(), req)
+	require.Contains(t, res.Error, errReplayedRequest.Error())
+	require.Equal(t, pb.ErrorCode_ERROR_CODE_REPLAYED_REQUEST, res.ErrorCode)
+
+	// Missing fields.
+	req.Nonce, req.Timestamp = "", 0
+	res = sendRawRequest(ctx, t, h2, h1.ID(), req)
+	require.Contains(t, res.Error, errReplayedRequest.Error())
+	require.Equal(t, pb.ErrorCode_ERROR_CODE_REPLAYED_REQUEST, res.ErrorCode)
+}
+
+func TestAddressPrefixes(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newSignerHosts(t, authToken, wallet)
+
+	proposal := correctProposalSecp256k1(t)
+	payload := &bytes.Buffer{}
+	require.NoError(t, proposal.MarshalCBOR(payload))
+	for _, prefix := range []string{"f", "t"} {
+		req := &pb.SigningRequest{
+			AuthToken:            authToken,
+			WalletAddress:        prefix + proposal.Client.String()[1:],
+			FilecoinDealProtocol: filDealProposalProtocolV1,
+			Payload:              payload.Bytes(),
+		}
+		res := sendRawRequest(ctx, t, h2, h1.ID(), req)
+		require.Empty(t, res.Error)
+	}
+}
+
+func TestRemoteWalletAddrs(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Relay libp2p host.
+	relay, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.EnableRelayService(),
+		libp2p.ForceReachabilityPublic())
+	require.NoError(t, err)
+	relayInfo := peer.AddrInfo{ID: relay.ID(), Addrs: relay.Addrs()}
+
+	// Remote wallet libp2p host, with a reservation in the relay.
+	h1, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.EnableRelay())
+	require.NoError(t, err)
+	servedPaths := make(chan ConnectionPath, 1)
+	err = NewDealSignerService(h1, authToken, wallet, WithAuditLog(auditFunc(func(ev SigningEvent) error {
+		servedPaths <- ev.ConnectionPath
+		return nil
+	})))
+	require.NoError(t, err)
+	require.NoError(t, h1.Connect(ctx, relayInfo))
+	_, err = circuitv2.Reserve(ctx, h1, relayInfo)
+	require.NoError(t, err)
+	relayedAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("%s/p2p/%s/p2p-circuit", relay.Addrs()[0], relay.ID()))
+	require.NoError(t, err)
+
+	proposal := correctProposalSecp256k1(t)
+	testCases := []struct {
+		name        string
+		directAddrs []multiaddr.Multiaddr
+		path        ConnectionPath
+	}{
+		{name: "direct", directAddrs: h1.Addrs(), path: ConnectionPathDirect},
+		{name: "relayed", directAddrs: []multiaddr.Multiaddr{unreachableAddr(t)}, path: ConnectionPathRelayed},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			// Client (dealerd) libp2p2 host, which doesn't know how to reach the remote wallet.
+			h2, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.EnableRelay())
+			require.NoError(t, err)
+			require.NoError(t, h2.Connect(ctx, relayInfo))
+
+			var path ConnectionPath
+			addrs := append(test.directAddrs, relayedAddr)
+			_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID(),
+				WithRemoteWalletAddrs(time.Minute, addrs...),
+				WithDirectDialTimeout(time.Second),
+				WithConnectionPathReport(func(p ConnectionPath) { path = p }))
+			require.NoError(t, err)
+			require.Equal(t, test.path, path)
+			require.Equal(t, test.path, <-servedPaths)
+		})
+	}
+
+	// Multiaddrs of other peers are rejected.
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	otherAddr, err := multiaddr.NewMultiaddr(fmt.Sprintf("%s/p2p/%s", h1.Addrs()[0], relay.ID()))
+	require.NoError(t, err)
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID(),
+		WithRemoteWalletAddrs(time.Minute, otherAddr))
+	require.Error(t, err)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The remote wallet host starts serving signing requests later.
+	h1, h2 := newConnectedHosts(t)
+
+	started := make(chan error, 1)
+	time.AfterFunc(100*time.Millisecond, func() {
+		started <- NewDealSignerService(h1, authToken, wallet)
+	})
+	policy := RetryPolicy{
+		MaxAttempts:    20,
+		InitialBackoff: 20 * time.Millisecond,
+		MaxBackoff:     100 * time.Millisecond,
+		Jitter:         0.5,
+	}
+	proposal := correctProposalSecp256k1(t)
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID(), WithRetryPolicy(policy))
+	require.NoError(t, err)
+	require.NoError(t, <-started)
+
+	// Errors returned by the remote wallet aren't retried.
+	policy.InitialBackoff, policy.MaxBackoff = time.Hour, time.Hour
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "wrongToken", proposal, h1.ID(), WithRetryPolicy(policy))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), errInvalidAuthToken.Error())
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID(), WithRetryPolicy(RetryPolicy{}))
+	require.Error(t, err)
+}
+
+func TestRetryPolicyErrors(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Remote wallet libp2p host.
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	err = NewDealSignerService(h1, authToken, wallet)
+	require.NoError(t, err)
+
+	// Client (dealerd) libp2p2 host.
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+
+	// Dial failures are retried, waiting the backoff between attempts.
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	proposal := correctProposalSecp256k1(t)
+	start := time.Now()
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID(),
+		WithRemoteWalletAddrs(time.Minute, unreachableAddr(t)),
+		WithRetryPolicy(policy))
+	require.Error(t, err)
+	require.True(t, isRetryable(err))
+	require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+
+	// Errors replied by the remote wallet stop retrying right away.
+	policy.InitialBackoff, policy.MaxBackoff = time.Hour, time.Hour
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "wrongToken", proposal, h1.ID(),
+		WithRemoteWalletAddrs(time.Minute, h1.Addrs()...),
+		WithRetryPolicy(policy))
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.False(t, isRetryable(err))
+
+	// The backoff is canceled with the context.
+	h3, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = RequestDealProposalSignatureV1(ctx, h3, authToken, proposal, h1.ID(),
+		WithRemoteWalletAddrs(time.Minute, unreachableAddr(t)),
+		WithDirectDialTimeout(50*time.Millisecond),
+		WithRetryPolicy(policy))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryPolicySentRequests(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The remote wallet host resets the stream after reading the request.
+	h1, h2 := newConnectedHosts(t)
+	var received int32
+	h1.SetStreamHandler(v1Protocol, func(s network.Stream) {
+		var req pb.SigningRequest
+		if err := readMsg(s, maxRequestMessageSize, &req); err == nil {
+			atomic.AddInt32(&received, 1)
+		}
+		_ = s.Reset()
+	})
+
+	// The remote wallet might have signed the request, so it isn't sent again.
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	_, err := RequestDealProposalSignatureV1(ctx, h2, "token", correctProposalSecp256k1(t), h1.ID(),
+		WithRetryPolicy(policy))
+	require.Error(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&received))
+}
+
+func TestRetryPolicyRateLimited(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The remote wallet host rate limits every request.
+	h1, h2 := newConnectedHosts(t)
+	var received int32
+	h1.SetStreamHandler(v1Protocol, func(s network.Stream) {
+		defer func() { _ = s.Close() }()
+		var req pb.SigningRequest
+		if err := readMsg(s, maxRequestMessageSize, &req); err == nil {
+			atomic.AddInt32(&received, 1)
+		}
+		replyWithError(s, pb.ErrorCode_ERROR_CODE_RATE_LIMITED, "too many requests")
+	})
+
+	// The remote wallet asked to retry later, so the request is sent again.
+	policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	_, err := RequestDealProposalSignatureV1(ctx, h2, "token", correctProposalSecp256k1(t), h1.ID(),
+		WithRetryPolicy(policy))
+	require.ErrorIs(t, err, ErrRateLimited)
+	require.True(t, isRetryable(err))
+	require.Equal(t, int32(3), atomic.LoadInt32(&received))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, time.Second, policy.backoff(1))
+	require.Equal(t, 2*time.Second, policy.backoff(2))
+	require.Equal(t, 4*time.Second, policy.backoff(3))
+	require.Equal(t, 5*time.Second, policy.backoff(4))
+	require.Equal(t, 5*time.Second, policy.backoff(100))
+}
+
+func TestErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	wallet, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rejectLabel := policyFunc(func(proposal market.DealProposal) error {
+		if proposal.Label == "rejected" {
+			return errors.New("label is rejected")
+		}
+		return nil
+	})
+	h1, h2 := newSignerHosts(t, authToken, wallet, WithDealProposalPolicy(rejectLabel))
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, "wrongToken", correctProposalSecp256k1(t), h1.ID())
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposalWithUnknownAddress(t), h1.ID())
+	require.ErrorIs(t, err, ErrUnknownAddress)
+
+	proposal := correctProposalSecp256k1(t)
+	proposal.Label = "rejected"
+	_, err = RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.ErrorIs(t, err, ErrPolicyRejected)
+
+	waddr := wallet.GetAddresses()[0]
+	_, err = RequestDealStatusSignatureV1(ctx, h2, authToken, waddr, []byte("not a cid"), h1.ID())
+	require.ErrorIs(t, err, ErrMalformedPayload)
+
+	req := &pb.SigningRequest{
+		AuthToken:            authToken,
+		WalletAddress:        waddr,
+		FilecoinDealProtocol: "/fil/storage/mk/9.9.9",
+	}
+	_, err = sendToRemoteWallet(ctx, h2, h1.ID(), req, nil)
+	require.ErrorIs(t, err, ErrUnsupportedProtocol)
+	require.False(t, isRetryable(err))
+
+	// Requests that can't be unmarshaled are malformed, with both signer protocols.
+	for _, p := range []protocol.ID{v1Protocol, v2Protocol} {
+		s, err := h2.NewStream(ctx, h1.ID(), p)
+		require.NoError(t, err)
+		if p == v2Protocol {
+			var challenge pb.AuthChallenge
+			require.NoError(t, readMsg(s, maxResponseMessageSize, &challenge))
+		}
+		garbage := []byte{0xff, 0xff}
+		_, err = s.Write(append([]byte{byte(len(garbage))}, garbage...))
+		require.NoError(t, err)
+		var res pb.SigningResponse
+		require.NoError(t, readMsg(s, maxResponseMessageSize, &res))
+		require.Equal(t, pb.ErrorCode_ERROR_CODE_MALFORMED_PAYLOAD, res.ErrorCode)
+		require.NoError(t, s.Close())
+	}
+}
+
+func TestWalletV2(t *testing.T) {
+	t.Parallel()
+
+	authToken := "veryhardtokentoguess"
+	lw, err := localwallet.New(walletKeys)
+	require.NoError(t, err)
+	wallet := &recordingWallet{WalletV2: AdaptWallet(lw)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := newConnectedHosts(t)
+	require.NoError(t, NewDealSignerServiceV2(h1, authToken, wallet))
+
+	proposal := correctProposalSecp256k1(t)
+	sig, err := RequestDealProposalSignatureV1(ctx, h2, authToken, proposal, h1.ID())
+	require.NoError(t, err)
+	require.NoError(t, ValidateDealProposalSignature(proposal, sig))
+
+	require.True(t, wallet.hadDeadline)
+	require.Equal(t, h2.ID(), wallet.info.RemotePeer)
+	require.NotNil(t, wallet.info.Proposal)
+	require.Equal(t, proposal.Provider, wallet.info.Proposal.Provider)
+	require.Empty(t, wallet.info.DealStatusRequest)
+}
+
+// newConnectedHosts returns a remote wallet libp2p host, and a client (dealerd) libp2p host
+// connected to it.
+func newConnectedHosts(t *testing.T) (host.Host, host.Host) {
+	t.Helper()
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	err = h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()})
+	require.NoError(t, err)
+	return h1, h2
+}
+
+// newSignerHosts is like newConnectedHosts, with the remote wallet host serving signing
+// requests for wallet.
+func newSignerHosts(t *testing.T, authToken string, wallet Wallet, opts ...Option) (host.Host, host.Host) {
+	t.Helper()
+	h1, h2 := newConnectedHosts(t)
+	require.NoError(t, NewDealSignerService(h1, authToken, wallet, opts...))
+	return h1, h2
+}
+
+func sendRawRequest(
+	ctx context.Context,
+	t *testing.T,
+	h host.Host,
+	rwPeerID peer.ID,
+	req *pb.SigningRequest) *pb.SigningResponse {
+	s, err := h.NewStream(ctx, rwPeerID, v1Protocol)
+	require.NoError(t, err)
+	defer func() { _ = s.Close() }()
+	require.NoError(t, writeMsg(s, req))
+	var res pb.SigningResponse
+	require.NoError(t, readMsg(s, maxResponseMessageSize, &res))
+	return &res
+}
+
+type recordingWallet struct {
+	WalletV2
+	hadDeadline bool
+	info        SigningRequestInfo
+}
+
+func (w *recordingWallet) Sign(
+	ctx context.Context,
+	addr string,
+	payload []byte,
+	info SigningRequestInfo) (*crypto.Signature, error) {
+	_, w.hadDeadline = ctx.Deadline()
+	w.info = info
+	return w.WalletV2.Sign(ctx, addr, payload, info)
+}
+
+type auditFunc func(ev SigningEvent) error
+
+func (f auditFunc) Record(ev SigningEvent) error {
+	return f(ev)
+}
+
+type policyFunc func(proposal market.DealProposal) error
+
+func (f policyFunc) Check(proposal market.DealProposal, _ []byte) error {
+	return f(proposal)
+}
+
 func correctProposalSecp256k1(t *testing.T) market.DealProposal {
 	secpAddr, err := libwal.PublicKey(walletKeys[0])
 	require.NoError(t, err)
@@ -178,6 +978,32 @@ func proposalWithUnknownAddress(t *testing.T) market.DealProposal {
 	return proposal
 }
 
+func toDealProposalV2(proposal market.DealProposal, label marketv8.DealLabel) marketv8.DealProposal {
+	return marketv8.DealProposal{
+		PieceCID:             proposal.PieceCID,
+		PieceSize:            proposal.PieceSize,
+		VerifiedDeal:         proposal.VerifiedDeal,
+		Client:               proposal.Client,
+		Provider:             proposal.Provider,
+		Label:                label,
+		StartEpoch:           proposal.StartEpoch,
+		EndEpoch:             proposal.EndEpoch,
+		StoragePricePerEpoch: proposal.StoragePricePerEpoch,
+		ProviderCollateral:   proposal.ProviderCollateral,
+		ClientCollateral:     proposal.ClientCollateral,
+	}
+}
+
+// unreachableAddr returns a multiaddr where nobody is listening.
+func unreachableAddr(t *testing.T) multiaddr.Multiaddr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr, err := manet.FromNetAddr(l.Addr())
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	return addr
+}
+
 func castCid(cidStr string) cid.Cid {
 	c, _ := cid.Decode(cidStr)
 	return c
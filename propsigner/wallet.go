@@ -0,0 +1,59 @@
+package propsigner
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/specs-actors/actors/builtin/market"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Wallet contains private keys for Filecoin addresses.
+type Wallet interface {
+	Has(addr string) (bool, error)
+	Sign(addr string, payload []byte) (*crypto.Signature, error)
+}
+
+// SigningRequestInfo describes the signing request that a payload belongs to.
+type SigningRequestInfo struct {
+	RemotePeer           peer.ID
+	TokenName            string
+	FilecoinDealProtocol string
+	// Proposal is the decoded deal proposal, if the request is for a deal proposal.
+	// Label is empty for bytes labels.
+	Proposal *market.DealProposal
+	// LabelBytes is the proposal label if it's raw bytes instead of a string.
+	LabelBytes []byte
+	// DealStatusRequest is the proposal CID or deal UUID, if the request is for a deal status.
+	DealStatusRequest string
+}
+
+// WalletV2 contains private keys for Filecoin addresses. Unlike Wallet, it receives
+// a context that is canceled when the signing stream deadline expires, and a description
+// of what is being signed, so implementations can make their own decisions.
+type WalletV2 interface {
+	Has(ctx context.Context, addr string) (bool, error)
+	Sign(ctx context.Context, addr string, payload []byte, info SigningRequestInfo) (*crypto.Signature, error)
+}
+
+// AdaptWallet returns a WalletV2 that delegates to w, ignoring the context and
+// the signing request description.
+func AdaptWallet(w Wallet) WalletV2 {
+	return walletAdapter{w: w}
+}
+
+type walletAdapter struct {
+	w Wallet
+}
+
+func (a walletAdapter) Has(_ context.Context, addr string) (bool, error) {
+	return a.w.Has(addr)
+}
+
+func (a walletAdapter) Sign(
+	_ context.Context,
+	addr string,
+	payload []byte,
+	_ SigningRequestInfo) (*crypto.Signature, error) {
+	return a.w.Sign(addr, payload)
+}
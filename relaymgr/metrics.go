@@ -0,0 +1,40 @@
+package relaymgr
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricConnected = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "auc_relay_connected",
+		Help: "Number of relays the host is connected to with a slot reservation",
+	})
+	metricReconnections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auc_relay_reconnections_total",
+		Help: "Reconnection attempts with relays by trigger and result",
+	}, []string{"trigger", "result"})
+	metricFailures = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "auc_relay_reconnect_failures",
+		Help: "Consecutive failed reconnection attempts with relays",
+	})
+	metricRenewals = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auc_relay_reservation_renewals_total",
+		Help: "Reservation renewals with relays by result",
+	}, []string{"result"})
+)
+
+func recordReconnection(trigger string, err error) {
+	metricReconnections.WithLabelValues(trigger, result(err)).Inc()
+}
+
+func recordRenewal(err error) {
+	metricRenewals.WithLabelValues(result(err)).Inc()
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
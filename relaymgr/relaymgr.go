@@ -11,6 +11,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/textileio/go-auctions-client/internal/backoff"
 	logger "github.com/textileio/go-log/v2"
 )
 
@@ -22,14 +23,106 @@ var (
 	log = logger.Logger("relaymgr")
 
 	pollFrequency = time.Second * 10
+	// renewalMargin is how long before expiring a reservation is refreshed.
+	renewalMargin = time.Minute * 5
+
+	defaultMaxReservations = 2
+	defaultBackoff         = Backoff{
+		MinDelay: time.Second,
+		MaxDelay: time.Minute * 5,
+		Jitter:   0.2,
+	}
+	defaultMaxAttempts = 10
 )
 
-// RelayManager connects a libp2p host to an external relay and do a best-effort
-// in keeping the connection healthy.
+// Backoff configures the delays between failed reconnection attempts with relays.
+type Backoff struct {
+	// MinDelay is the delay after the first failed attempt, which doubles with each failure.
+	MinDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// Jitter is the fraction of each delay, between 0 and 1, that is randomized.
+	Jitter float64
+}
+
+// delay returns the wait after the failed attempt.
+func (b Backoff) delay(attempt int) time.Duration {
+	return backoff.Exponential(b.MinDelay, b.MaxDelay, b.Jitter, attempt)
+}
+
+// Option configures the relay manager.
+type Option func(*RelayManager) error
+
+// WithMaxReservations sets how many relays the host keeps slot reservations with at
+// once. The default is 2.
+func WithMaxReservations(n int) Option {
+	return func(rm *RelayManager) error {
+		if n < 1 {
+			return fmt.Errorf("max reservations must be at least 1")
+		}
+		rm.maxReservations = n
+		return nil
+	}
+}
+
+// WithReconnectBackoff configures the delays between failed reconnection attempts, so
+// a recovering relay isn't hammered. The default is from 1 second to 5 minutes, with
+// 20% jitter.
+func WithReconnectBackoff(backoff Backoff) Option {
+	return func(rm *RelayManager) error {
+		if backoff.MinDelay <= 0 || backoff.MaxDelay < backoff.MinDelay {
+			return fmt.Errorf("delays must be positive and max delay can't be less than min delay")
+		}
+		if backoff.Jitter < 0 || backoff.Jitter > 1 {
+			return fmt.Errorf("jitter must be between 0 and 1")
+		}
+		rm.backoff = backoff
+		return nil
+	}
+}
+
+// WithMaxReconnectAttempts sets how many consecutive reconnection attempts can fail
+// before alerting with an error log. Reconnections are still attempted after that.
+// The default is 10.
+func WithMaxReconnectAttempts(n int) Option {
+	return func(rm *RelayManager) error {
+		if n < 1 {
+			return fmt.Errorf("max reconnect attempts must be at least 1")
+		}
+		rm.maxAttempts = n
+		return nil
+	}
+}
+
+// relay is a configured relay, and the state of the host reservation with it.
+type relay struct {
+	addr       multiaddr.Multiaddr
+	info       peer.AddrInfo
+	reserved   bool
+	expiration time.Time
+	lastErr    error
+}
+
+// RelayManager connects a libp2p host to external relays and do a best-effort
+// in keeping healthy connections with them.
 type RelayManager struct {
-	host        host.Host
-	relayAddr   peer.AddrInfo
-	connNotifee *connNotifee
+	host            host.Host
+	maxReservations int
+	backoff         Backoff
+	maxAttempts     int
+	connNotifee     *connNotifee
+	// reconnect signals the reconnect loop that a relay was disconnected.
+	reconnect chan struct{}
+
+	// fillLock serializes reserving slots with relays, which involves network calls,
+	// while lock only guards the relays state.
+	fillLock sync.Mutex
+	lock     sync.Mutex
+	relays   []*relay
+	failures int
+
+	subsLock sync.Mutex
+	subs     map[chan Event]struct{}
 
 	closeOnce   sync.Once
 	closeCtx    context.Context
@@ -37,107 +130,357 @@ type RelayManager struct {
 	closed      chan struct{}
 }
 
-// New connects the provided host to the remote relay, doing a best-effort
-// in keeping the connection healthy. The provided context is only used for
-// the initial connection to the relay. To shutdown call Close().
-func New(ctx context.Context, h host.Host, relayMultiaddress string) (*RelayManager, error) {
-	relayAddr, err := multiaddr.NewMultiaddr(relayMultiaddress)
-	if err != nil {
-		return nil, fmt.Errorf("parsing relay multiaddr: %s", err)
+// New connects the provided host to the remote relays, keeping slot reservations with
+// up to a maximum number of them at once. Relays are preferred in the provided order,
+// and if one becomes unhealthy the next available one is used instead.
+// The provided context is only used for the initial connections to the relays.
+// To shutdown call Close().
+func New(ctx context.Context, h host.Host, relayMultiaddresses []string, opts ...Option) (*RelayManager, error) {
+	if len(relayMultiaddresses) == 0 {
+		return nil, fmt.Errorf("relay multiaddrs list is empty")
 	}
-	addrInfo, err := peer.AddrInfoFromP2pAddr(relayAddr)
-	if err != nil {
-		return nil, fmt.Errorf("get addr-info from relay multiaddr: %s", err)
+	relays := make([]*relay, 0, len(relayMultiaddresses))
+	for _, relayMultiaddress := range relayMultiaddresses {
+		relayAddr, err := multiaddr.NewMultiaddr(relayMultiaddress)
+		if err != nil {
+			return nil, fmt.Errorf("parsing relay multiaddr: %s", err)
+		}
+		addrInfo, err := peer.AddrInfoFromP2pAddr(relayAddr)
+		if err != nil {
+			return nil, fmt.Errorf("get addr-info from relay multiaddr: %s", err)
+		}
+		relays = append(relays, &relay{addr: relayAddr, info: *addrInfo})
 	}
 
 	closeCtx, closeSignal := context.WithCancel(context.Background())
 	rm := &RelayManager{
-		host:      h,
-		relayAddr: *addrInfo,
+		host:            h,
+		maxReservations: defaultMaxReservations,
+		backoff:         defaultBackoff,
+		maxAttempts:     defaultMaxAttempts,
+		reconnect:       make(chan struct{}, 1),
+		relays:          relays,
+		subs:            map[chan Event]struct{}{},
 
 		closeCtx:    closeCtx,
 		closeSignal: closeSignal,
 		closed:      make(chan struct{}),
 	}
+	for _, opt := range opts {
+		if err := opt(rm); err != nil {
+			closeSignal()
+			return nil, fmt.Errorf("applying option: %s", err)
+		}
+	}
 	rm.connNotifee = &connNotifee{rm: rm}
 	h.Network().Notify(rm.connNotifee)
 
-	if err := rm.connect(); err != nil {
-		return nil, fmt.Errorf("connecting to relay: %s", err)
+	if err := rm.fillReservations(ctx, "startup"); err != nil {
+		h.Network().StopNotify(rm.connNotifee)
+		closeSignal()
+		return nil, fmt.Errorf("connecting to relays: %s", err)
 	}
 
-	go rm.keepHealthy()
+	go rm.reconnectLoop()
 
 	return rm, nil
 }
 
-// Close stops relay manager work to keep a healthy connection with the relay.
+// RelayedAddrs returns the /p2p-circuit multiaddrs of the host through the relays it
+// currently has slot reservations with.
+func (rm *RelayManager) RelayedAddrs() []multiaddr.Multiaddr {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	var addrs []multiaddr.Multiaddr
+	for _, r := range rm.relays {
+		if r.reserved {
+			addrs = append(addrs, rm.relayedAddr(r))
+		}
+	}
+	return addrs
+}
+
+func (rm *RelayManager) relayedAddr(r *relay) multiaddr.Multiaddr {
+	return r.addr.Encapsulate(multiaddr.StringCast("/p2p-circuit/p2p/" + rm.host.ID().String()))
+}
+
+// Close stops relay manager work to keep healthy connections with the relays.
 func (rm *RelayManager) Close() error {
 	rm.closeOnce.Do(func() {
 		log.Infof("closing relay manager")
 
-		rm.host.ConnManager().Unprotect(rm.relayAddr.ID, connProtectTag)
 		rm.host.Network().StopNotify(rm.connNotifee)
 		rm.closeSignal()
 		<-rm.closed
+
+		rm.lock.Lock()
+		for _, r := range rm.relays {
+			rm.host.ConnManager().Unprotect(r.info.ID, connProtectTag)
+			r.reserved = false
+		}
+		rm.lock.Unlock()
+		metricConnected.Set(0)
+		metricFailures.Set(0)
+		rm.closeSubs()
 		log.Infof("relay manager closed")
 	})
 	return nil
 }
 
-func (rm *RelayManager) keepHealthy() {
+// reconnectLoop is the only place where reservations are refilled after startup. It
+// checks the health of the relays periodically, and refills reservations when some are
+// lost, waiting with backoff between failed attempts.
+func (rm *RelayManager) reconnectLoop() {
 	defer close(rm.closed)
+
+	poll := time.NewTicker(pollFrequency)
+	defer poll.Stop()
+	retry := time.NewTimer(0)
+	if !retry.Stop() {
+		<-retry.C
+	}
+	var backingOff bool
 	for {
+		var trigger string
 		select {
 		case <-rm.closeCtx.Done():
-			log.Debugf("closing healthy checker")
+			log.Debugf("closing reconnect loop")
+			retry.Stop()
 			return
-		case <-time.After(pollFrequency):
-			isProtected := rm.host.ConnManager().IsProtected(rm.relayAddr.ID, "")
-			connStatus := rm.host.Network().Connectedness(rm.relayAddr.ID)
+		case <-poll.C:
+			rm.checkHealth()
+			rm.renewReservations()
+			trigger = "poller"
+		case <-rm.reconnect:
+			trigger = "disconnected"
+		case <-retry.C:
+			backingOff = false
+			trigger = "backoff"
+		}
+		// The retry timer reconnects once the backoff is over.
+		if backingOff {
+			continue
+		}
+		if rm.isFull() {
+			log.Debugf("relay connections are healthy")
+			continue
+		}
+
+		if err := rm.fillReservations(rm.closeCtx, trigger); err != nil {
+			log.Warnf("%s reconnect: %s", trigger, err)
+		}
+		if rm.isFull() {
+			rm.recordAttempt(false)
+			continue
+		}
+		attempt := rm.recordAttempt(true)
+		if attempt == rm.maxAttempts {
+			log.Errorf("reconnecting with relays failed %d consecutive times, reservations: %d",
+				attempt, len(rm.RelayedAddrs()))
+		}
+		delay := rm.backoff.delay(attempt)
+		log.Debugf("retrying to reconnect with relays in %s", delay)
+		retry.Reset(delay)
+		backingOff = true
+	}
+}
+
+// checkHealth marks reservations with relays that aren't connected anymore as lost.
+func (rm *RelayManager) checkHealth() {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	for _, r := range rm.relays {
+		if !r.reserved {
+			continue
+		}
+		isProtected := rm.host.ConnManager().IsProtected(r.info.ID, "")
+		connStatus := rm.host.Network().Connectedness(r.info.ID)
+		if !isProtected || connStatus != network.Connected {
+			log.Warnf("detected unhealthy status of connection with relay %s (protected: %t, connStatus: %s)",
+				r.info.ID, isProtected, connStatus)
+			r.reserved = false
+			r.lastErr = fmt.Errorf("unhealthy connection (protected: %t, connStatus: %s)", isProtected, connStatus)
+			rm.emit(EventDisconnected, r, time.Time{}, r.lastErr)
+		}
+	}
+}
+
+// isFull reports if there are as many reservations as wanted, or with all the relays if
+// there are fewer.
+func (rm *RelayManager) isFull() bool {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	wanted := rm.maxReservations
+	if len(rm.relays) < wanted {
+		wanted = len(rm.relays)
+	}
+	return rm.reservationsCount() >= wanted
+}
+
+// recordAttempt updates the count of consecutive failed reconnection attempts, and
+// returns it.
+func (rm *RelayManager) recordAttempt(failed bool) int {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	if failed {
+		rm.failures++
+	} else {
+		rm.failures = 0
+	}
+	metricFailures.Set(float64(rm.failures))
+	return rm.failures
+}
+
+// fillReservations reserves slots with the relays, in order, until there are enough
+// reservations. It returns an error if there isn't any reservation.
+func (rm *RelayManager) fillReservations(ctx context.Context, trigger string) error {
+	rm.fillLock.Lock()
+	defer rm.fillLock.Unlock()
+
+	var lastErr error
+	for _, r := range rm.relays {
+		rm.lock.Lock()
+		done, reserved := rm.reservationsCount() >= rm.maxReservations, r.reserved
+		rm.lock.Unlock()
+		if done {
+			break
+		}
+		if reserved {
+			continue
+		}
+		expiration, err := rm.connect(ctx, r)
+		recordReconnection(trigger, err)
+		if err != nil {
+			log.Warnf("connecting with relay %s: %s", r.info.ID, err)
+			lastErr = err
+			rm.lock.Lock()
+			r.lastErr = err
+			rm.lock.Unlock()
+			rm.emit(EventReservationFailed, r, time.Time{}, err)
+			continue
+		}
+		rm.lock.Lock()
+		r.reserved, r.expiration, r.lastErr = true, expiration, nil
+		rm.lock.Unlock()
+		rm.emit(EventConnected, r, expiration, nil)
+	}
 
-			if !isProtected || connStatus != network.Connected {
-				log.Warnf("detected unhealthy status of connection (protected: %t, connStatus: %s)", isProtected, connStatus)
-				if err := rm.connect(); err != nil {
-					log.Errorf("poller reconnect: %s", err)
-					continue
-				}
-			}
-			log.Debugf("relay connection is healthy")
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	count := rm.reservationsCount()
+	metricConnected.Set(float64(count))
+	if count == 0 {
+		return fmt.Errorf("no relay reservations, last error: %s", lastErr)
+	}
+	return nil
+}
+
+func (rm *RelayManager) reservationsCount() int {
+	var count int
+	for _, r := range rm.relays {
+		if r.reserved {
+			count++
+		}
+	}
+	return count
+}
+
+// renewReservations refreshes the reservations that are about to expire, since relays
+// drop them even if the connection stays up. Reservations that can't be refreshed are
+// considered unhealthy.
+func (rm *RelayManager) renewReservations() {
+	rm.fillLock.Lock()
+	defer rm.fillLock.Unlock()
+
+	for _, r := range rm.relays {
+		rm.lock.Lock()
+		renew := r.reserved && time.Until(r.expiration) < renewalMargin
+		rm.lock.Unlock()
+		if !renew {
+			continue
+		}
+
+		log.Debugf("renewing reservation with relay %s", r.info.ID)
+		expiration, err := rm.reserve(rm.closeCtx, r)
+		recordRenewal(err)
+		if err != nil {
+			log.Warnf("renewing reservation with relay %s: %s", r.info.ID, err)
+			rm.host.ConnManager().Unprotect(r.info.ID, connProtectTag)
+			rm.lock.Lock()
+			r.reserved, r.lastErr = false, err
+			rm.lock.Unlock()
+			rm.emit(EventReservationFailed, r, time.Time{}, err)
+			rm.emit(EventDisconnected, r, time.Time{}, err)
+			continue
 		}
+		rm.lock.Lock()
+		r.expiration = expiration
+		rm.lock.Unlock()
+		rm.emit(EventReservationRenewed, r, expiration, nil)
 	}
 }
 
-func (rm *RelayManager) connect() error {
-	log.Infof("connecting with relay...")
-	err := rm.host.Connect(rm.closeCtx, rm.relayAddr)
+func (rm *RelayManager) connect(ctx context.Context, r *relay) (time.Time, error) {
+	log.Infof("connecting with relay %s...", r.info.ID)
+	err := rm.host.Connect(ctx, r.info)
 	if err != nil {
-		return fmt.Errorf("connecting to relay: %s", err)
+		return time.Time{}, fmt.Errorf("connecting to relay: %s", err)
 	}
-	rm.host.ConnManager().Protect(rm.relayAddr.ID, connProtectTag)
-	log.Infof("connected with relay")
+	rm.host.ConnManager().Protect(r.info.ID, connProtectTag)
+	log.Infof("connected with relay %s", r.info.ID)
 
-	_, err = circuitv2.Reserve(rm.closeCtx, rm.host, peer.AddrInfo{
-		ID: rm.relayAddr.ID,
-	})
+	expiration, err := rm.reserve(ctx, r)
 	if err != nil {
-		return fmt.Errorf("reserving relay slot: %s", err)
+		rm.host.ConnManager().Unprotect(r.info.ID, connProtectTag)
+		return time.Time{}, err
 	}
 
-	return nil
+	return expiration, nil
+}
+
+// reserve reserves, or refreshes, a slot in the relay and returns when it expires.
+func (rm *RelayManager) reserve(ctx context.Context, r *relay) (time.Time, error) {
+	rsvp, err := circuitv2.Reserve(ctx, rm.host, peer.AddrInfo{
+		ID: r.info.ID,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reserving relay slot: %s", err)
+	}
+	log.Debugf("reservation with relay %s expires at %s", r.info.ID, rsvp.Expiration)
+	return rsvp.Expiration, nil
 }
 
 type connNotifee struct {
 	rm *RelayManager
 }
 
-func (n *connNotifee) Disconnected(_ network.Network, ne network.Conn) {
-	if ne.RemotePeer() == n.rm.relayAddr.ID {
-		log.Warnf("disconnected from remote relay")
-		if err := n.rm.connect(); err != nil {
-			log.Errorf("notifee reconnect: %s", err)
+func (n *connNotifee) Disconnected(net network.Network, ne network.Conn) {
+	// Other connections with the relay might still be open.
+	if net.Connectedness(ne.RemotePeer()) == network.Connected {
+		return
+	}
+	n.rm.lock.Lock()
+	var disconnected bool
+	for _, r := range n.rm.relays {
+		if r.reserved && r.info.ID == ne.RemotePeer() {
+			r.reserved = false
+			r.lastErr = fmt.Errorf("disconnected")
+			disconnected = true
+			n.rm.emit(EventDisconnected, r, time.Time{}, r.lastErr)
 		}
 	}
+	n.rm.lock.Unlock()
+	if !disconnected {
+		return
+	}
+
+	log.Warnf("disconnected from remote relay %s", ne.RemotePeer())
+	// Notifees must not block the network, so only the reconnect loop is signaled. If
+	// it was already signaled, it will see this disconnection too.
+	select {
+	case n.rm.reconnect <- struct{}{}:
+	default:
+	}
 }
 func (n *connNotifee) Connected(_ network.Network, ne network.Conn)         {}
 func (n *connNotifee) OpenedStream(_ network.Network, s network.Stream)     {}
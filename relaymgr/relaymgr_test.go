@@ -0,0 +1,177 @@
+package relaymgr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	connmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailover(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay1, relay2 := newRelay(t), newRelay(t)
+	// The first relay isn't reachable.
+	unreachable, err := libp2p.New(libp2p.NoListenAddrs)
+	require.NoError(t, err)
+	relayMaddrs := []string{
+		fmt.Sprintf("/ip4/127.0.0.1/tcp/1/p2p/%s", unreachable.ID()),
+		p2pAddr(t, relay1),
+		p2pAddr(t, relay2),
+	}
+
+	h := newHost(t)
+	rm, err := New(ctx, h, relayMaddrs, WithMaxReservations(1))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, rm.Close()) }()
+
+	require.Equal(t, []string{p2pAddr(t, relay1) + "/p2p-circuit/p2p/" + h.ID().String()}, relayedAddrs(rm))
+
+	// Losing the relay fails over to the next one.
+	relay2Circuit := p2pAddr(t, relay2) + "/p2p-circuit/p2p/" + h.ID().String()
+	require.NoError(t, relay1.Close())
+	require.Eventually(t, func() bool {
+		addrs := relayedAddrs(rm)
+		return len(addrs) == 1 && addrs[0] == relay2Circuit
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func TestMaxReservations(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relayMaddrs := []string{p2pAddr(t, newRelay(t)), p2pAddr(t, newRelay(t)), p2pAddr(t, newRelay(t))}
+	h := newHost(t)
+	rm, err := New(ctx, h, relayMaddrs)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, rm.Close()) }()
+	require.Len(t, rm.RelayedAddrs(), defaultMaxReservations)
+
+	_, err = New(ctx, h, nil)
+	require.Error(t, err)
+	_, err = New(ctx, h, relayMaddrs, WithMaxReservations(0))
+	require.Error(t, err)
+}
+
+// TestReservationRenewal isn't parallel, since it changes the poll frequency.
+func TestReservationRenewal(t *testing.T) {
+	oldPollFrequency, oldRenewalMargin := pollFrequency, renewalMargin
+	pollFrequency, renewalMargin = 100*time.Millisecond, 4*time.Second
+	defer func() { pollFrequency, renewalMargin = oldPollFrequency, oldRenewalMargin }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rc := relayv2.DefaultResources()
+	rc.ReservationTTL = 5 * time.Second
+	relay := newRelay(t, relayv2.WithResources(rc))
+	h := newHost(t)
+	rm, err := New(ctx, h, []string{p2pAddr(t, relay)})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, rm.Close()) }()
+
+	expiration := func() time.Time {
+		rm.lock.Lock()
+		defer rm.lock.Unlock()
+		return rm.relays[0].expiration
+	}
+	firstExpiration := expiration()
+	require.False(t, firstExpiration.IsZero())
+
+	// The reservation is refreshed once it's about to expire, without reconnecting.
+	require.Eventually(t, func() bool {
+		return expiration().After(firstExpiration)
+	}, 10*time.Second, 50*time.Millisecond)
+	require.Len(t, rm.RelayedAddrs(), 1)
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay := newRelay(t)
+	h := newHost(t)
+	backoff := Backoff{MinDelay: 200 * time.Millisecond, MaxDelay: 400 * time.Millisecond}
+	rm, err := New(ctx, h, []string{p2pAddr(t, relay)}, WithReconnectBackoff(backoff), WithMaxReconnectAttempts(3))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, rm.Close()) }()
+
+	failures := func() int {
+		rm.lock.Lock()
+		defer rm.lock.Unlock()
+		return rm.failures
+	}
+
+	// While the relay is down, reconnections are attempted with increasing delays.
+	start := time.Now()
+	require.NoError(t, relay.Close())
+	require.Eventually(t, func() bool { return failures() >= 3 }, 10*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), backoff.MinDelay+backoff.MaxDelay)
+	require.Empty(t, rm.RelayedAddrs())
+
+	_, err = New(ctx, h, []string{p2pAddr(t, relay)}, WithReconnectBackoff(Backoff{MinDelay: time.Second}))
+	require.Error(t, err)
+	_, err = New(ctx, h, []string{p2pAddr(t, relay)}, WithMaxReconnectAttempts(0))
+	require.Error(t, err)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+
+	b := Backoff{MinDelay: time.Second, MaxDelay: 5 * time.Second}
+	require.Equal(t, time.Second, b.delay(1))
+	require.Equal(t, 2*time.Second, b.delay(2))
+	require.Equal(t, 4*time.Second, b.delay(3))
+	require.Equal(t, 5*time.Second, b.delay(4))
+	require.Equal(t, 5*time.Second, b.delay(100))
+}
+
+// newHost returns a host with a connection manager, so relay connections are protected
+// as in the daemon.
+func newHost(t *testing.T) host.Host {
+	cm, err := connmgr.NewConnManager(10, 20)
+	require.NoError(t, err)
+	h, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.EnableRelay(),
+		libp2p.ConnectionManager(cm))
+	require.NoError(t, err)
+	return h
+}
+
+func newRelay(t *testing.T, opts ...relayv2.Option) host.Host {
+	h, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.EnableRelayService(opts...),
+		libp2p.ForceReachabilityPublic())
+	require.NoError(t, err)
+	return h
+}
+
+func p2pAddr(t *testing.T, h host.Host) string {
+	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+	require.NoError(t, err)
+	return addrs[0].String()
+}
+
+func relayedAddrs(rm *RelayManager) []string {
+	var res []string
+	for _, addr := range rm.RelayedAddrs() {
+		res = append(res, addr.String())
+	}
+	return res
+}
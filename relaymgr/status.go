@@ -0,0 +1,137 @@
+package relaymgr
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+)
+
+const (
+	eventsBufferSize = 16
+)
+
+// EventType is the kind of change in the reservation with a relay.
+type EventType string
+
+const (
+	// EventConnected is emitted when a slot is reserved with a relay, so the host is
+	// reachable through it.
+	EventConnected EventType = "connected"
+	// EventDisconnected is emitted when the reservation with a relay is lost.
+	EventDisconnected EventType = "disconnected"
+	// EventReservationRenewed is emitted when the reservation with a relay is refreshed.
+	EventReservationRenewed EventType = "reservation-renewed"
+	// EventReservationFailed is emitted when reserving, or refreshing, a slot with a relay fails.
+	EventReservationFailed EventType = "reservation-failed"
+)
+
+// Event is a change in the reservation with a relay.
+type Event struct {
+	Type  EventType
+	Relay peer.ID
+	// RelayedAddr is the /p2p-circuit multiaddr of the host through the relay.
+	RelayedAddr multiaddr.Multiaddr
+	// Expiration is when the reservation expires, for connected and renewed events.
+	Expiration time.Time
+	// Err is the cause of disconnected and failed events.
+	Err error
+}
+
+// RelayStatus is the state of the host reservation with a relay.
+type RelayStatus struct {
+	Relay peer.ID
+	Addr  multiaddr.Multiaddr
+	// Connectedness is the state of the host connection with the relay.
+	Connectedness network.Connectedness
+	// Reserved is true if the host has a slot reservation with the relay.
+	Reserved bool
+	// Expiration is when the current reservation expires.
+	Expiration time.Time
+	// LastError is the last error reserving a slot with the relay, or losing it.
+	// It's cleared when a slot is reserved.
+	LastError error
+	// RelayedAddr is the /p2p-circuit multiaddr of the host through the relay, if it's reserved.
+	RelayedAddr multiaddr.Multiaddr
+}
+
+// Status returns the state of the host reservations with the configured relays, in order
+// of preference.
+func (rm *RelayManager) Status() []RelayStatus {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+	res := make([]RelayStatus, 0, len(rm.relays))
+	for _, r := range rm.relays {
+		rs := RelayStatus{
+			Relay:         r.info.ID,
+			Addr:          r.addr,
+			Connectedness: rm.host.Network().Connectedness(r.info.ID),
+			Reserved:      r.reserved,
+			Expiration:    r.expiration,
+			LastError:     r.lastErr,
+		}
+		if r.reserved {
+			rs.RelayedAddr = rm.relayedAddr(r)
+		}
+		res = append(res, rs)
+	}
+	return res
+}
+
+// Subscribe returns a channel with the changes in the reservations with relays, and a
+// function to unsubscribe. The channel is closed when unsubscribing or closing the relay
+// manager. Events aren't queued indefinitely: if the subscriber falls behind, they're
+// dropped, and Status can be used to catch up.
+func (rm *RelayManager) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventsBufferSize)
+
+	rm.subsLock.Lock()
+	defer rm.subsLock.Unlock()
+	if rm.subs == nil {
+		close(ch)
+		return ch, func() {}
+	}
+	rm.subs[ch] = struct{}{}
+	unsubscribe := func() {
+		rm.subsLock.Lock()
+		defer rm.subsLock.Unlock()
+		if _, ok := rm.subs[ch]; ok {
+			delete(rm.subs, ch)
+			close(ch)
+		}
+	}
+	return ch, unsubscribe
+}
+
+// emit sends the event to subscribers without blocking, since it may be called from
+// network notifications.
+func (rm *RelayManager) emit(typ EventType, r *relay, expiration time.Time, err error) {
+	ev := Event{
+		Type:        typ,
+		Relay:       r.info.ID,
+		RelayedAddr: rm.relayedAddr(r),
+		Expiration:  expiration,
+		Err:         err,
+	}
+
+	rm.subsLock.Lock()
+	defer rm.subsLock.Unlock()
+	for ch := range rm.subs {
+		select {
+		case ch <- ev:
+		default:
+			log.Warnf("dropping %s event of relay %s for slow subscriber", typ, r.info.ID)
+		}
+	}
+}
+
+// closeSubs closes the channels of all subscribers.
+func (rm *RelayManager) closeSubs() {
+	rm.subsLock.Lock()
+	defer rm.subsLock.Unlock()
+	for ch := range rm.subs {
+		close(ch)
+	}
+	rm.subs = nil
+}
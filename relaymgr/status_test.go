@@ -0,0 +1,80 @@
+package relaymgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusAndEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	relay1, relay2 := newRelay(t), newRelay(t)
+	h := newHost(t)
+	rm, err := New(ctx, h, []string{p2pAddr(t, relay1), p2pAddr(t, relay2)}, WithMaxReservations(1))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, rm.Close()) }()
+	events, unsubscribe := rm.Subscribe()
+	closedEvents, _ := rm.Subscribe()
+
+	status := rm.Status()
+	require.Len(t, status, 2)
+	require.Equal(t, relay1.ID(), status[0].Relay)
+	require.Equal(t, network.Connected, status[0].Connectedness)
+	require.True(t, status[0].Reserved)
+	require.True(t, status[0].Expiration.After(time.Now()))
+	require.NoError(t, status[0].LastError)
+	require.Equal(t, rm.RelayedAddrs()[0], status[0].RelayedAddr)
+	require.Equal(t, relay2.ID(), status[1].Relay)
+	require.False(t, status[1].Reserved)
+	require.Nil(t, status[1].RelayedAddr)
+
+	// Losing the relay emits a disconnected event, and failing over a connected one.
+	require.NoError(t, relay1.Close())
+	ev := nextEvent(t, events)
+	require.Equal(t, EventDisconnected, ev.Type)
+	require.Equal(t, relay1.ID(), ev.Relay)
+	require.Error(t, ev.Err)
+	// Relays are tried in order, so reconnecting with the lost one fails first.
+	ev = nextEvent(t, events)
+	require.Equal(t, EventReservationFailed, ev.Type)
+	require.Equal(t, relay1.ID(), ev.Relay)
+	require.Error(t, ev.Err)
+	ev = nextEvent(t, events)
+	require.Equal(t, EventConnected, ev.Type)
+	require.Equal(t, relay2.ID(), ev.Relay)
+	require.Equal(t, p2pAddr(t, relay2)+"/p2p-circuit/p2p/"+h.ID().String(), ev.RelayedAddr.String())
+	require.True(t, ev.Expiration.After(time.Now()))
+
+	status = rm.Status()
+	require.False(t, status[0].Reserved)
+	require.Error(t, status[0].LastError)
+	require.True(t, status[1].Reserved)
+
+	// Channels are closed after any buffered events.
+	unsubscribe()
+	for range events {
+	}
+	require.NoError(t, rm.Close())
+	for range closedEvents {
+	}
+	events, _ = rm.Subscribe()
+	_, ok := <-events
+	require.False(t, ok)
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for event")
+		return Event{}
+	}
+}
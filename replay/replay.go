@@ -0,0 +1,185 @@
+package replay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errNonceUsed = errors.New("nonce already used")
+
+	pruneFrequency = time.Minute
+)
+
+// Store is a persistent set of used nonces. Nonces are forgotten after they
+// expire, since requests with old timestamps are rejected anyway.
+type Store struct {
+	lock      sync.Mutex
+	path      string
+	f         *os.File
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// Open opens the nonce store persisted in path, creating it if doesn't exist.
+func Open(path string) (*Store, error) {
+	nonces, err := load(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading nonces: %s", err)
+	}
+	f, err := compact(path, nonces)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		path:      path,
+		f:         f,
+		nonces:    nonces,
+		lastPrune: time.Now(),
+	}, nil
+}
+
+// Use marks the nonce as used until expiresAt. It returns an error if the
+// nonce was already used.
+func (s *Store) Use(nonce string, expiresAt time.Time) error {
+	if nonce == "" || strings.ContainsAny(nonce, " \n") {
+		return fmt.Errorf("invalid nonce")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastPrune) > pruneFrequency {
+		if err := s.prune(now); err != nil {
+			return err
+		}
+	}
+	if exp, ok := s.nonces[nonce]; ok && now.Before(exp) {
+		return errNonceUsed
+	}
+	if _, err := s.f.WriteString(formatLine(nonce, expiresAt)); err != nil {
+		return fmt.Errorf("persisting nonce: %s", err)
+	}
+	if err := s.f.Sync(); err != nil {
+		return fmt.Errorf("syncing nonces file: %s", err)
+	}
+	s.nonces[nonce] = expiresAt
+
+	return nil
+}
+
+// prune forgets the expired nonces, and compacts the file if any of them expired.
+func (s *Store) prune(now time.Time) error {
+	pruned := 0
+	for n, exp := range s.nonces {
+		if now.After(exp) {
+			delete(s.nonces, n)
+			pruned++
+		}
+	}
+	s.lastPrune = now
+	if pruned == 0 {
+		return nil
+	}
+	f, err := compact(s.path, s.nonces)
+	if err != nil {
+		return err
+	}
+	if err := s.f.Close(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("closing replaced nonces file: %s", err)
+	}
+	s.f = f
+	return nil
+}
+
+// Close closes the store.
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("closing nonces file: %s", err)
+	}
+	return nil
+}
+
+func load(path string) (map[string]time.Time, error) {
+	nonces := map[string]time.Time{}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nonces, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d is malformed", line)
+		}
+		unix, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing expiration in line %d: %s", line, err)
+		}
+		if expiresAt := time.Unix(unix, 0); now.Before(expiresAt) {
+			nonces[parts[1]] = expiresAt
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading nonces file: %s", err)
+	}
+	return nonces, nil
+}
+
+// compact rewrites the file in path with the nonces, so it doesn't grow forever with
+// expired ones, and opens it for appending.
+func compact(path string, nonces map[string]time.Time) (*os.File, error) {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating compacted nonces file: %s", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for nonce, expiresAt := range nonces {
+		if _, err := w.WriteString(formatLine(nonce, expiresAt)); err != nil {
+			_ = tmp.Close()
+			return nil, fmt.Errorf("writing compacted nonces file: %s", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("flushing compacted nonces file: %s", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return nil, fmt.Errorf("syncing compacted nonces file: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("closing compacted nonces file: %s", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("replacing nonces file: %s", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening nonces file: %s", err)
+	}
+	return f, nil
+}
+
+func formatLine(nonce string, expiresAt time.Time) string {
+	// Round up to the next second so the persisted expiration is never earlier than expiresAt.
+	return strconv.FormatInt(expiresAt.Add(time.Second-1).Unix(), 10) + " " + nonce + "\n"
+}
@@ -0,0 +1,67 @@
+package replay
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUse(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "nonces")
+	s, err := Open(path)
+	require.NoError(t, err)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, s.Use("nonce1", expiresAt))
+	require.ErrorIs(t, s.Use("nonce1", expiresAt), errNonceUsed)
+	require.NoError(t, s.Use("nonce2", expiresAt))
+	require.NoError(t, s.Use("expired", time.Now().Add(-time.Second)))
+	require.Error(t, s.Use("", expiresAt))
+	require.NoError(t, s.Close())
+
+	// Used nonces are remembered across restarts, but expired ones are forgotten.
+	s, err = Open(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+	require.ErrorIs(t, s.Use("nonce1", expiresAt), errNonceUsed)
+	require.ErrorIs(t, s.Use("nonce2", expiresAt), errNonceUsed)
+	require.NoError(t, s.Use("expired", expiresAt))
+	require.Len(t, s.nonces, 3)
+}
+
+func TestCompaction(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "nonces")
+	s, err := Open(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, s.Close()) }()
+
+	lines := func() int {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return strings.Count(string(content), "\n")
+	}
+	require.NoError(t, s.Use("valid", time.Now().Add(time.Hour)))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, s.Use(fmt.Sprintf("expired%d", i), time.Now().Add(-time.Second)))
+	}
+	require.Equal(t, 11, lines())
+
+	// The next periodic prune compacts the file with the nonces that haven't expired.
+	s.lastPrune = time.Time{}
+	require.NoError(t, s.Use("fresh", time.Now().Add(time.Hour)))
+	require.Equal(t, 2, lines())
+	require.ErrorIs(t, s.Use("valid", time.Now().Add(time.Hour)), errNonceUsed)
+
+	// Nonces used after compacting are appended to the new file.
+	require.NoError(t, s.Use("another", time.Now().Add(time.Hour)))
+	require.Equal(t, 3, lines())
+}